@@ -0,0 +1,193 @@
+package senbiotpkg
+
+import (
+	"fmt"
+	"go.bug.st/serial.v1"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snapshot is the readable configuration of a module, to restore on another one
+type Snapshot struct {
+	Date     string            `yaml:"date"`
+	Model    string            `yaml:"model"`
+	Firmware string            `yaml:"firmware"`
+	NConfig  map[string]string `yaml:"nconfig"`
+	NCDP     string            `yaml:"ncdp,omitempty"`
+	NCDPPort string            `yaml:"ncdpport,omitempty"`
+	PDP      []PDPContext      `yaml:"cgdcont"`
+	Bands    []int             `yaml:"nband"`
+	PSM      *PSMTimers        `yaml:"cpsms,omitempty"`
+	EDRX     string            `yaml:"cedrxs,omitempty"`
+	CFUN     int               `yaml:"cfun"`
+	// Missing lists the settings the module does not support, eg cedrxs
+	Missing []string `yaml:"missing,omitempty"`
+}
+
+// PDPContext is a PDP context definition of AT+CGDCONT
+type PDPContext struct {
+	CID  int    `yaml:"cid"`
+	Type string `yaml:"type"`
+	APN  string `yaml:"apn"`
+}
+
+// PSMTimers are the requested PSM timers of AT+CPSMS as 3GPP bit strings
+type PSMTimers struct {
+	PeriodicTAU string `yaml:"t3412"`
+	ActiveTime  string `yaml:"t3324"`
+}
+
+// ReadSnapshot reads the NCONFIG, NCDP, CGDCONT, NBAND, PSM, eDRX and CFUN
+// settings of the module. A setting the module answers with an error is
+// recorded in Missing and left out.
+func ReadSnapshot(port serial.Port) (Snapshot, error) {
+	s := Snapshot{Date: time.Now().Format("2006-01-02"), NConfig: make(map[string]string)}
+	id, err := Identify(port)
+	if err != nil {
+		return s, err
+	}
+	s.Model, s.Firmware = id.Model, id.Firmware
+
+	read := func(request, prefix string, add func(params []string)) error {
+		response, err := SendCommand(port, request, DefaultTimeout)
+		if err != nil {
+			return err
+		}
+		for _, line := range response {
+			if strings.HasPrefix(line, prefix) {
+				add(splitParams(strings.TrimPrefix(line, prefix)))
+			}
+		}
+		return nil
+	}
+	reads := []struct {
+		setting, request, prefix string
+		add                      func(params []string)
+	}{
+		{"nconfig", "AT+NCONFIG?", "+NCONFIG:", func(p []string) {
+			if len(p) == 2 {
+				s.NConfig[p[0]] = p[1]
+			}
+		}},
+		{"ncdp", "AT+NCDP?", "+NCDP:", func(p []string) {
+			s.NCDP = p[0]
+			if len(p) > 1 {
+				s.NCDPPort = p[1]
+			}
+		}},
+		{"cgdcont", "AT+CGDCONT?", "+CGDCONT:", func(p []string) {
+			if len(p) >= 3 {
+				cid, _ := strconv.Atoi(p[0])
+				s.PDP = append(s.PDP, PDPContext{CID: cid, Type: p[1], APN: p[2]})
+			}
+		}},
+		{"nband", "AT+NBAND?", "+NBAND:", func(p []string) {
+			s.Bands = parseBands(strings.Join(p, ","))
+		}},
+		{"cpsms", "AT+CPSMS?", "+CPSMS:", func(p []string) {
+			if len(p) >= 5 && p[0] == "1" {
+				s.PSM = &PSMTimers{PeriodicTAU: p[3], ActiveTime: p[4]}
+			}
+		}},
+		{"cedrxs", "AT+CEDRXS?", "+CEDRXS:", func(p []string) {
+			// only the NB-IoT access technology
+			if len(p) >= 2 && p[0] == "5" {
+				s.EDRX = p[1]
+			}
+		}},
+		{"cfun", "AT+CFUN?", "+CFUN:", func(p []string) {
+			s.CFUN, _ = strconv.Atoi(p[0])
+		}},
+	}
+	for _, r := range reads {
+		err := read(r.request, r.prefix, r.add)
+		if _, unsupported := err.(*CommandError); unsupported {
+			s.Missing = append(s.Missing, r.setting)
+		} else if err != nil {
+			return s, fmt.Errorf("%s: %v", r.request, err)
+		}
+	}
+	return s, nil
+}
+
+// Sequence validates the snapshot and turns it into an init sequence for the
+// module of setup c. NCONFIG parameters are quoted when the init sequence of
+// the setup quotes them, as the 02B firmware wants.
+func (s Snapshot) Sequence(c Setup) ([]RequestResponse, error) {
+	quote := func(v string) string { return v }
+	for _, v := range c.Init {
+		if strings.HasPrefix(v.Request, "AT+NCONFIG=\"") {
+			quote = func(v string) string { return "\"" + v + "\"" }
+		}
+	}
+	ok := func(request string) RequestResponse {
+		return RequestResponse{Request: request, Response: "OK"}
+	}
+
+	sequence := []RequestResponse{ok("AT+CFUN=0")}
+	keys := make([]string, 0, len(s.NConfig))
+	for key := range s.NConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := s.NConfig[key]
+		if len(key) == 0 || strings.ContainsAny(key+value, ",\"") {
+			return nil, fmt.Errorf("invalid NCONFIG %s=%s", key, value)
+		}
+		sequence = append(sequence, ok(fmt.Sprintf("AT+NCONFIG=%s,%s", quote(key), quote(value))))
+	}
+	if len(s.NCDP) != 0 {
+		if net.ParseIP(s.NCDP) == nil {
+			return nil, fmt.Errorf("invalid NCDP address %s", s.NCDP)
+		}
+		request := "AT+NCDP=" + quote(s.NCDP)
+		if len(s.NCDPPort) != 0 {
+			if _, err := strconv.Atoi(s.NCDPPort); err != nil {
+				return nil, fmt.Errorf("invalid NCDP port %s", s.NCDPPort)
+			}
+			request += "," + s.NCDPPort
+		}
+		sequence = append(sequence, ok(request))
+	}
+	for _, p := range s.PDP {
+		if p.CID < 0 || len(p.Type) == 0 || strings.Contains(p.APN, "\"") {
+			return nil, fmt.Errorf("invalid PDP context %+v", p)
+		}
+		sequence = append(sequence, ok(fmt.Sprintf("AT+CGDCONT=%d,\"%s\",\"%s\"", p.CID, p.Type, p.APN)))
+	}
+	if len(s.Bands) != 0 {
+		sequence = append(sequence, ok("AT+NBAND="+bandList(s.Bands)))
+	}
+	if s.PSM != nil {
+		if _, err := DecodeT3412(s.PSM.PeriodicTAU); err != nil {
+			return nil, err
+		}
+		if _, err := DecodeT3324(s.PSM.ActiveTime); err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, ok(fmt.Sprintf("AT+CPSMS=1,,,\"%s\",\"%s\"", s.PSM.PeriodicTAU, s.PSM.ActiveTime)))
+	}
+	if len(s.EDRX) != 0 {
+		if _, err := DecodeEDRX(s.EDRX); err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, ok(fmt.Sprintf("AT+CEDRXS=1,5,\"%s\"", s.EDRX)))
+	}
+	if s.CFUN == 1 {
+		sequence = append(sequence, ok("AT+CFUN=1"))
+	}
+	return sequence, nil
+}
+
+// RestoreSnapshot writes the settings of the snapshot to the module of setup c
+func RestoreSnapshot(port serial.Port, s Snapshot, c Setup) error {
+	sequence, err := s.Sequence(c)
+	if err != nil {
+		return err
+	}
+	return RunSequence(port, sequence)
+}
@@ -0,0 +1,71 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	answers := map[string][]string{
+		"AT+CGMM":     {"SARA-N211", "OK"},
+		"AT+CGMR":     {"06.57,A07", "OK"},
+		"AT+NCONFIG?": {"+NCONFIG:AUTOCONNECT,FALSE", "+NCONFIG:CR_0354_0338_SCRAMBLING,TRUE", "OK"},
+		"AT+NCDP?":    {"+NCDP:172.16.4.22,5683", "OK"},
+		"AT+CGDCONT?": {`+CGDCONT:1,"IP","nb.inetd.gdsp",,0,0,,,,,0`, "OK"},
+		"AT+NBAND?":   {"+NBAND:8,20", "OK"},
+		"AT+CPSMS?":   {`+CPSMS:1,,,"00100001","00000101"`, "OK"},
+		"AT+CEDRXS?":  {"ERROR"},
+		"AT+CFUN?":    {"+CFUN:1", "OK"},
+	}
+	port := newFakePort(func(request string) []string {
+		if answer, ok := answers[request]; ok {
+			return answer
+		}
+		return []string{"ERROR"}
+	})
+	defer port.Close()
+
+	s, err := ReadSnapshot(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Date = ""
+	want := Snapshot{
+		Model:    "SARA-N211",
+		Firmware: "06.57,A07",
+		NConfig:  map[string]string{"AUTOCONNECT": "FALSE", "CR_0354_0338_SCRAMBLING": "TRUE"},
+		NCDP:     "172.16.4.22",
+		NCDPPort: "5683",
+		PDP:      []PDPContext{{CID: 1, Type: "IP", APN: "nb.inetd.gdsp"}},
+		Bands:    []int{8, 20},
+		PSM:      &PSMTimers{PeriodicTAU: "00100001", ActiveTime: "00000101"},
+		CFUN:     1,
+		Missing:  []string{"cedrxs"},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v\nwant %+v", s, want)
+	}
+
+	sequence, err := s.Sequence(Setup{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests []string
+	for _, v := range sequence {
+		requests = append(requests, v.Request)
+	}
+	wantRequests := []string{
+		"AT+CFUN=0",
+		"AT+NCONFIG=AUTOCONNECT,FALSE",
+		"AT+NCONFIG=CR_0354_0338_SCRAMBLING,TRUE",
+		"AT+NCDP=172.16.4.22,5683",
+		`AT+CGDCONT=1,"IP","nb.inetd.gdsp"`,
+		"AT+NBAND=8,20",
+		`AT+CPSMS=1,,,"00100001","00000101"`,
+		"AT+CFUN=1",
+	}
+	if strings.Join(requests, "\n") != strings.Join(wantRequests, "\n") {
+		t.Errorf("sequence\n%s\nwant\n%s", strings.Join(requests, "\n"), strings.Join(wantRequests, "\n"))
+	}
+}
@@ -0,0 +1,413 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A small CBOR (RFC 7049) encoder and decoder for the values JSON can hold,
+// plus byte strings. Maps decode to map[interface{}]interface{} like yaml,
+// integers to int64 or uint64 and floats to float64.
+
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+func init() {
+	RegisterFormat(cborFormat{})
+}
+
+// cborFormat turns any JSON value into CBOR
+type cborFormat struct{}
+
+func (cborFormat) Name() string { return "cbor" }
+
+func (cborFormat) Encode(data []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return MarshalCBOR(v)
+}
+
+func (cborFormat) Decode(payload []byte) ([]byte, error) {
+	v, err := UnmarshalCBOR(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(jsonValue(v), "", "  ")
+}
+
+// jsonValue makes a decoded CBOR value printable as JSON, map keys become strings
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+	}
+	return v
+}
+
+// MarshalCBOR encodes v as CBOR. Floats take the shortest of half, single
+// and double precision that keeps their value, map keys are sorted the
+// canonical way.
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	var buf []byte
+	err := appendCBOR(&buf, v)
+	return buf, err
+}
+
+func appendHead(buf *[]byte, major byte, n uint64) {
+	switch {
+	case n < 24:
+		*buf = append(*buf, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		*buf = append(*buf, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		*buf = append(*buf, major<<5|25)
+		*buf = append(*buf, make([]byte, 2)...)
+		binary.BigEndian.PutUint16((*buf)[len(*buf)-2:], uint16(n))
+	case n <= math.MaxUint32:
+		*buf = append(*buf, major<<5|26)
+		*buf = append(*buf, make([]byte, 4)...)
+		binary.BigEndian.PutUint32((*buf)[len(*buf)-4:], uint32(n))
+	default:
+		*buf = append(*buf, major<<5|27)
+		*buf = append(*buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64((*buf)[len(*buf)-8:], n)
+	}
+}
+
+func appendInt(buf *[]byte, n int64) {
+	if n < 0 {
+		appendHead(buf, cborNegint, uint64(-1-n))
+		return
+	}
+	appendHead(buf, cborUint, uint64(n))
+}
+
+func appendFloat(buf *[]byte, f float64) {
+	if h, ok := halfFloat(f); ok {
+		*buf = append(*buf, cborSimple<<5|25, byte(h>>8), byte(h))
+		return
+	}
+	if float64(float32(f)) == f || math.IsNaN(f) {
+		*buf = append(*buf, cborSimple<<5|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32((*buf)[len(*buf)-4:], math.Float32bits(float32(f)))
+		return
+	}
+	*buf = append(*buf, cborSimple<<5|27, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64((*buf)[len(*buf)-8:], math.Float64bits(f))
+}
+
+// halfFloat returns f as IEEE 754 half precision when that keeps its value
+func halfFloat(f float64) (uint16, bool) {
+	switch {
+	case math.IsNaN(f):
+		return 0x7e00, true
+	case math.IsInf(f, 1):
+		return 0x7c00, true
+	case math.IsInf(f, -1):
+		return 0xfc00, true
+	}
+	if float64(float32(f)) != f {
+		return 0, false
+	}
+	bits := math.Float32bits(float32(f))
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+	if exp == -127 && mant == 0 {
+		return sign, true
+	}
+	if exp < -14 && exp >= -24 {
+		// subnormal, the mantissa with its leading one shifted below 2^-14
+		shift := uint(13 + -14 - exp)
+		m := mant | 0x800000
+		if m&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(m>>shift), true
+	}
+	if exp < -14 || exp > 15 || mant&0x1fff != 0 {
+		return 0, false
+	}
+	return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+}
+
+func fromHalf(h uint16) float64 {
+	exp := int(h >> 10 & 0x1f)
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+func appendCBOR(buf *[]byte, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		*buf = append(*buf, cborSimple<<5|22)
+	case bool:
+		if v {
+			*buf = append(*buf, cborSimple<<5|21)
+		} else {
+			*buf = append(*buf, cborSimple<<5|20)
+		}
+	case int:
+		appendInt(buf, int64(v))
+	case int8:
+		appendInt(buf, int64(v))
+	case int16:
+		appendInt(buf, int64(v))
+	case int32:
+		appendInt(buf, int64(v))
+	case int64:
+		appendInt(buf, v)
+	case uint:
+		appendHead(buf, cborUint, uint64(v))
+	case uint8:
+		appendHead(buf, cborUint, uint64(v))
+	case uint16:
+		appendHead(buf, cborUint, uint64(v))
+	case uint32:
+		appendHead(buf, cborUint, uint64(v))
+	case uint64:
+		appendHead(buf, cborUint, v)
+	case float32:
+		appendFloat(buf, float64(v))
+	case float64:
+		appendFloat(buf, v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			appendInt(buf, n)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		appendFloat(buf, f)
+	case string:
+		appendHead(buf, cborText, uint64(len(v)))
+		*buf = append(*buf, v...)
+	case []byte:
+		appendHead(buf, cborBytes, uint64(len(v)))
+		*buf = append(*buf, v...)
+	case []interface{}:
+		appendHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := appendCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for key, value := range v {
+			m[key] = value
+		}
+		return appendMap(buf, m)
+	case map[interface{}]interface{}:
+		return appendMap(buf, v)
+	default:
+		return fmt.Errorf("cannot encode %T as CBOR", v)
+	}
+	return nil
+}
+
+func appendMap(buf *[]byte, m map[interface{}]interface{}) error {
+	type entry struct {
+		key   []byte
+		value interface{}
+	}
+	entries := make([]entry, 0, len(m))
+	for key, value := range m {
+		k, err := MarshalCBOR(key)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{k, value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return bytes.Compare(a, b) < 0
+	})
+	appendHead(buf, cborMap, uint64(len(entries)))
+	for _, e := range entries {
+		*buf = append(*buf, e.key...)
+		if err := appendCBOR(buf, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalCBOR decodes a single CBOR data item. Tags are skipped, indefinite
+// lengths are not supported.
+func UnmarshalCBOR(data []byte) (interface{}, error) {
+	d := cborDecoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("CBOR: %d bytes left after the data item", len(data)-d.pos)
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errCBORShort = errors.New("CBOR: unexpected end of data")
+
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errCBORShort
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head returns the major type, the additional information and its argument
+func (d *cborDecoder) head() (byte, byte, uint64, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		arg, err := d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range arg {
+			n = n<<8 | uint64(c)
+		}
+	case info == 31:
+		return 0, 0, 0, fmt.Errorf("CBOR: indefinite length at byte %d is not supported", d.pos-1)
+	default:
+		return 0, 0, 0, fmt.Errorf("CBOR: invalid additional information %d at byte %d", info, d.pos-1)
+	}
+	return major, info, n, nil
+}
+
+func (d *cborDecoder) value() (interface{}, error) {
+	start := d.pos
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegint:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("CBOR: negative integer at byte %d overflows", start)
+		}
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(b), nil
+		}
+		return append([]byte{}, b...), nil
+	case cborArray:
+		if n > uint64(len(d.data)) {
+			return nil, errCBORShort
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = d.value(); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case cborMap:
+		if n > uint64(len(d.data)) {
+			return nil, errCBORShort
+		}
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case []interface{}, map[interface{}]interface{}, []byte:
+				return nil, fmt.Errorf("CBOR: unsupported map key %T at byte %d", key, start)
+			}
+			if m[key], err = d.value(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case cborTag:
+		return d.value()
+	}
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return fromHalf(uint16(n)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 27:
+		return math.Float64frombits(n), nil
+	}
+	return nil, fmt.Errorf("CBOR: unsupported simple value %d at byte %d", n, start)
+}
@@ -0,0 +1,126 @@
+package senbiotpkg
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// the examples of RFC 7049 appendix A
+var cborTests = []struct {
+	value   interface{}
+	encoded string
+}{
+	{int64(0), "00"},
+	{int64(1), "01"},
+	{int64(10), "0a"},
+	{int64(23), "17"},
+	{int64(24), "1818"},
+	{int64(100), "1864"},
+	{int64(1000), "1903e8"},
+	{int64(1000000), "1a000f4240"},
+	{int64(1000000000000), "1b000000e8d4a51000"},
+	{uint64(18446744073709551615), "1bffffffffffffffff"},
+	{int64(-1), "20"},
+	{int64(-10), "29"},
+	{int64(-100), "3863"},
+	{int64(-1000), "3903e7"},
+	{0.0, "f90000"},
+	{1.0, "f93c00"},
+	{1.1, "fb3ff199999999999a"},
+	{1.5, "f93e00"},
+	{65504.0, "f97bff"},
+	{100000.0, "fa47c35000"},
+	{3.4028234663852886e+38, "fa7f7fffff"},
+	{1.0e+300, "fb7e37e43c8800759c"},
+	{5.960464477539063e-8, "f90001"},
+	{0.00006103515625, "f90400"},
+	{-4.0, "f9c400"},
+	{-4.1, "fbc010666666666666"},
+	{math.Inf(1), "f97c00"},
+	{math.Inf(-1), "f9fc00"},
+	{false, "f4"},
+	{true, "f5"},
+	{nil, "f6"},
+	{"", "60"},
+	{"a", "6161"},
+	{"IETF", "6449455446"},
+	{"ü", "62c3bc"},
+	{[]byte{}, "40"},
+	{[]byte{1, 2, 3, 4}, "4401020304"},
+	{[]interface{}{}, "80"},
+	{[]interface{}{int64(1), int64(2), int64(3)}, "83010203"},
+	{[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}, "8301820203820405"},
+	{map[interface{}]interface{}{}, "a0"},
+	{map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}, "a201020304"},
+	{map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, "a26161016162820203"},
+	{[]interface{}{"a", map[interface{}]interface{}{"b": "c"}}, "826161a161626163"},
+}
+
+func TestMarshalCBOR(t *testing.T) {
+	for _, test := range cborTests {
+		got, err := MarshalCBOR(test.value)
+		if err != nil || hex.EncodeToString(got) != test.encoded {
+			t.Errorf("MarshalCBOR(%#v) = %x, %v, want %s", test.value, got, err, test.encoded)
+		}
+	}
+	if got, _ := MarshalCBOR(math.NaN()); hex.EncodeToString(got) != "f97e00" {
+		t.Errorf("MarshalCBOR(NaN) = %x, want f97e00", got)
+	}
+	if _, err := MarshalCBOR(struct{}{}); err == nil {
+		t.Error("struct encoded as CBOR")
+	}
+}
+
+func TestUnmarshalCBOR(t *testing.T) {
+	for _, test := range cborTests {
+		data, _ := hex.DecodeString(test.encoded)
+		got, err := UnmarshalCBOR(data)
+		if err != nil || !reflect.DeepEqual(got, test.value) {
+			t.Errorf("UnmarshalCBOR(%s) = %#v, %v, want %#v", test.encoded, got, err, test.value)
+		}
+	}
+	// a tagged value decodes to the value, 1(1363896240) is an epoch time
+	data, _ := hex.DecodeString("c11a514b67b0")
+	if got, err := UnmarshalCBOR(data); err != nil || got != int64(1363896240) {
+		t.Errorf("UnmarshalCBOR(c11a514b67b0) = %#v, %v", got, err)
+	}
+}
+
+func TestUnmarshalCBORErrors(t *testing.T) {
+	for _, encoded := range []string{
+		"",                   // no data
+		"18",                 // argument cut off
+		"6449455",            // text cut off
+		"9f0102ff",           // indefinite length
+		"0000",               // data after the item
+		"a1800102",           // array as map key
+		"1c",                 // reserved additional information
+		"3bffffffffffffffff", // negative overflow
+		"9bffffffffffffffff", // array longer than the data
+	} {
+		data, _ := hex.DecodeString(encoded)
+		if v, err := UnmarshalCBOR(data); err == nil {
+			t.Errorf("UnmarshalCBOR(%s) = %#v, want an error", encoded, v)
+		}
+	}
+}
+
+func TestCBORFormat(t *testing.T) {
+	f, err := FormatByName("cbor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := f.Encode([]byte(`{"temp":21.5,"count":3,"tags":["a","b"],"ok":true,"none":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a5626f6bf5646e6f6e65f6647461677382616161626474656d70f94d6065636f756e7403"
+	if hex.EncodeToString(payload) != want {
+		t.Errorf("cbor Encode = %x, want %s", payload, want)
+	}
+	if _, err := f.Decode(payload); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,159 @@
+package senbiotpkg
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// AES-CCM (RFC 3610), the AEAD most NB-IoT microcontrollers have in hardware
+
+type ccm struct {
+	block     cipher.Block
+	tagSize   int
+	nonceSize int
+}
+
+// NewCCM returns block (a 128 bit block cipher like AES) in CCM mode with
+// a tag of tagSize bytes (4 to 16, even) and nonces of nonceSize bytes (7 to 13)
+func NewCCM(block cipher.Block, tagSize, nonceSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.New("ccm: needs a 128 bit block cipher")
+	}
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 {
+		return nil, errors.New("ccm: invalid tag size")
+	}
+	if nonceSize < 7 || nonceSize > 13 {
+		return nil, errors.New("ccm: invalid nonce size")
+	}
+	return &ccm{block: block, tagSize: tagSize, nonceSize: nonceSize}, nil
+}
+
+func (c *ccm) NonceSize() int { return c.nonceSize }
+func (c *ccm) Overhead() int  { return c.tagSize }
+
+// maxLength is the longest message the length field of 15-nonceSize bytes holds
+func (c *ccm) maxLength() uint64 {
+	l := uint(15 - c.nonceSize)
+	if l >= 8 {
+		return 1<<63 - 1
+	}
+	return 1<<(8*l) - 1
+}
+
+// counterBlock returns A_i: the flags, the nonce and counter i
+func (c *ccm) counterBlock(nonce []byte, i uint64) []byte {
+	a := make([]byte, 16)
+	a[0] = byte(14 - c.nonceSize)
+	copy(a[1:], nonce)
+	for k := 15; k > c.nonceSize; k-- {
+		a[k] = byte(i)
+		i >>= 8
+	}
+	return a
+}
+
+// mac returns the CBC-MAC of the message and additional data
+func (c *ccm) mac(nonce, plaintext, data []byte) []byte {
+	b := make([]byte, 16)
+	if len(data) > 0 {
+		b[0] = 0x40
+	}
+	b[0] |= byte((c.tagSize-2)/2)<<3 | byte(14-c.nonceSize)
+	copy(b[1:], nonce)
+	n := uint64(len(plaintext))
+	for k := 15; k > c.nonceSize; k-- {
+		b[k] = byte(n)
+		n >>= 8
+	}
+	x := make([]byte, 16)
+	c.block.Encrypt(x, b)
+
+	mix := func(src []byte) {
+		for len(src) > 0 {
+			n := copy(b, src)
+			for k := n; k < 16; k++ {
+				b[k] = 0
+			}
+			src = src[n:]
+			for k := range x {
+				x[k] ^= b[k]
+			}
+			c.block.Encrypt(x, x)
+		}
+	}
+	if len(data) > 0 {
+		var encoded []byte
+		switch {
+		case len(data) < 0xff00:
+			encoded = []byte{byte(len(data) >> 8), byte(len(data))}
+		case uint64(len(data)) <= 0xffffffff:
+			encoded = []byte{0xff, 0xfe, byte(len(data) >> 24), byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}
+		default:
+			n := uint64(len(data))
+			encoded = []byte{0xff, 0xff, byte(n >> 56), byte(n >> 48), byte(n >> 40), byte(n >> 32),
+				byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+		}
+		mix(append(encoded, data...))
+	}
+	mix(plaintext)
+	return x[:c.tagSize]
+}
+
+// ctr xors src with the key stream from counter 1 on into dst
+func (c *ccm) ctr(nonce, dst, src []byte) {
+	s := make([]byte, 16)
+	for i := uint64(1); len(src) > 0; i++ {
+		c.block.Encrypt(s, c.counterBlock(nonce, i))
+		n := len(src)
+		if n > 16 {
+			n = 16
+		}
+		for k := 0; k < n; k++ {
+			dst[k] = src[k] ^ s[k]
+		}
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// tag encrypts the CBC-MAC with the key stream of counter 0
+func (c *ccm) tag(nonce, mac []byte) []byte {
+	s := make([]byte, 16)
+	c.block.Encrypt(s, c.counterBlock(nonce, 0))
+	t := make([]byte, c.tagSize)
+	for k := range t {
+		t[k] = mac[k] ^ s[k]
+	}
+	return t
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, data []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("ccm: invalid nonce length")
+	}
+	if uint64(len(plaintext)) > c.maxLength() {
+		panic("ccm: message too large")
+	}
+	out := make([]byte, len(plaintext)+c.tagSize)
+	c.ctr(nonce, out, plaintext)
+	copy(out[len(plaintext):], c.tag(nonce, c.mac(nonce, plaintext, data)))
+	return append(dst, out...)
+}
+
+var errCCMOpen = errors.New("ccm: message authentication failed")
+
+func (c *ccm) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		return nil, errors.New("ccm: invalid nonce length")
+	}
+	if len(ciphertext) < c.tagSize || uint64(len(ciphertext)-c.tagSize) > c.maxLength() {
+		return nil, errCCMOpen
+	}
+	n := len(ciphertext) - c.tagSize
+	plaintext := make([]byte, n)
+	c.ctr(nonce, plaintext, ciphertext[:n])
+	if subtle.ConstantTimeCompare(c.tag(nonce, c.mac(nonce, plaintext, data)), ciphertext[n:]) != 1 {
+		return nil, errCCMOpen
+	}
+	return append(dst, plaintext...), nil
+}
@@ -0,0 +1,98 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// packet vectors of RFC 3610 section 8, the output is the header followed
+// by the ciphertext and the tag
+var ccmVectors = []struct {
+	name    string
+	tagSize int
+	nonce   string
+	header  int
+	input   string
+	output  string
+}{
+	{"#1", 8, "00000003020100a0a1a2a3a4a5", 8,
+		"00010203 04050607 08090a0b 0c0d0e0f 10111213 14151617 18191a1b 1c1d1e",
+		"00010203 04050607 588c979a 61c663d2 f066d0c2 c0f98980 6d5f6b61 dac38417 e8d12cfd f926e0"},
+	{"#2", 8, "00000004030201a0a1a2a3a4a5", 8,
+		"00010203 04050607 08090a0b 0c0d0e0f 10111213 14151617 18191a1b 1c1d1e1f",
+		"00010203 04050607 72c91a36 e135f8cf 291ca894 085c87e3 cc15c439 c9e43a3b a091d56e 10400916"},
+	{"#3", 8, "00000005040302a0a1a2a3a4a5", 8,
+		"00010203 04050607 08090a0b 0c0d0e0f 10111213 14151617 18191a1b 1c1d1e1f 20",
+		"00010203 04050607 51b1e5f4 4a197d1d a46b0f8e 2d282ae8 71e838bb 64da8596 574adaa7 6fbd9fb0 c5"},
+	{"#4", 8, "00000006050403a0a1a2a3a4a5", 12,
+		"00010203 04050607 08090a0b 0c0d0e0f 10111213 14151617 18191a1b 1c1d1e",
+		"00010203 04050607 08090a0b a28c6865 939a9a79 faaa5c4c 2a9d4a91 cdac8c96 c861b9c9 e61ef1"},
+	{"#7", 10, "00000009080706a0a1a2a3a4a5", 8,
+		"00010203 04050607 08090a0b 0c0d0e0f 10111213 14151617 18191a1b 1c1d1e",
+		"00010203 04050607 0135d1b2 c95f41d5 d1d4fec1 85d166b8 094e999d fed96c04 8c56602c 97acbb74 90"},
+}
+
+func TestCCMVectors(t *testing.T) {
+	block, err := aes.NewCipher(unhex(t, "c0c1c2c3 c4c5c6c7 c8c9cacb cccdcecf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range ccmVectors {
+		aead, err := NewCCM(block, v.tagSize, 13)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce, input, output := unhex(t, v.nonce), unhex(t, v.input), unhex(t, v.output)
+		header, plaintext := input[:v.header], input[v.header:]
+		sealed := aead.Seal(append([]byte(nil), header...), nonce, plaintext, header)
+		if !bytes.Equal(sealed, output) {
+			t.Errorf("%s: Seal = %x, want %x", v.name, sealed, output)
+		}
+		opened, err := aead.Open(nil, nonce, output[v.header:], header)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Errorf("%s: Open = %x, %v, want %x", v.name, opened, err, plaintext)
+		}
+		// a changed header, ciphertext or tag is not authentic
+		for _, i := range []int{0, v.header, len(output) - 1} {
+			changed := append([]byte(nil), output...)
+			changed[i] ^= 0x01
+			if _, err := aead.Open(nil, nonce, changed[v.header:], changed[:v.header]); err == nil {
+				t.Errorf("%s: Open with byte %d changed succeeded", v.name, i)
+			}
+		}
+	}
+}
+
+func TestNewCCMSizes(t *testing.T) {
+	block, _ := aes.NewCipher(make([]byte, 16))
+	tests := []struct {
+		tagSize, nonceSize int
+		ok                 bool
+	}{
+		{8, 13, true},
+		{4, 7, true},
+		{16, 12, true},
+		{2, 13, false},
+		{9, 13, false},
+		{18, 13, false},
+		{8, 6, false},
+		{8, 14, false},
+	}
+	for _, test := range tests {
+		if _, err := NewCCM(block, test.tagSize, test.nonceSize); (err == nil) != test.ok {
+			t.Errorf("NewCCM(tag %d, nonce %d) = %v", test.tagSize, test.nonceSize, err)
+		}
+	}
+}
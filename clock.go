@@ -0,0 +1,99 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseCCLK parses the network time of AT+CCLK?, eg 17/11/21,14:03:12+04,
+// which is the local time and the offset to UTC in quarters of an hour
+func ParseCCLK(value string) (time.Time, error) {
+	value = strings.Trim(strings.TrimSpace(value), "\"")
+	i := strings.LastIndexAny(value, "+-")
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("no time zone in %q", value)
+	}
+	quarters, err := strconv.Atoi(value[i:])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time zone in %q", value)
+	}
+	sign := value[i : i+1]
+	q := quarters
+	if q < 0 {
+		q = -q
+	}
+	zone := time.FixedZone(fmt.Sprintf("UTC%s%02d:%02d", sign, q/4, q%4*15), quarters*15*60)
+	t, err := time.ParseInLocation("06/01/02,15:04:05", value[:i], zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %v", value, err)
+	}
+	return t, nil
+}
+
+// ReadNetworkTime returns the time the module got from the network
+func ReadNetworkTime(port serial.Port) (time.Time, error) {
+	response, err := SendCommand(port, "AT+CCLK?", DefaultTimeout)
+	if err != nil {
+		return time.Time{}, err
+	}
+	value, ok := responseValue(response, "+CCLK:")
+	if !ok {
+		return time.Time{}, errors.New("no +CCLK in response")
+	}
+	return ParseCCLK(value)
+}
+
+// NetworkClock tells the network time without asking the module again. It
+// runs on the monotonic clock of the host, so changes of the host clock do
+// not affect it.
+type NetworkClock struct {
+	network time.Time
+	synced  time.Time
+}
+
+// BuildYear is the year the package was built, it can be set with
+// -ldflags "-X github.com/johanhenselmans/senbiotpkg.BuildYear=2027".
+// A module that has no network time yet reports a time before it.
+var BuildYear = "2026"
+
+// ErrNoNetworkTime is returned when the module has not got the time from the network yet
+var ErrNoNetworkTime = errors.New("module has no network time yet")
+
+// checkNetworkTime returns ErrNoNetworkTime for a time before BuildYear
+func checkNetworkTime(t time.Time) error {
+	year, err := strconv.Atoi(BuildYear)
+	if err != nil {
+		return fmt.Errorf("invalid build year %q", BuildYear)
+	}
+	if t.Year() < year {
+		return ErrNoNetworkTime
+	}
+	return nil
+}
+
+// SyncNetworkClock reads the network time and returns a clock running from
+// it, or ErrNoNetworkTime when the module has no network time yet
+func SyncNetworkClock(port serial.Port) (*NetworkClock, error) {
+	t, err := ReadNetworkTime(port)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNetworkTime(t); err != nil {
+		return nil, err
+	}
+	return &NetworkClock{network: t, synced: time.Now()}, nil
+}
+
+// Now returns the current network time
+func (c *NetworkClock) Now() time.Time {
+	return c.network.Add(time.Since(c.synced))
+}
+
+// Offset returns how far the host clock is ahead of the network time
+func (c *NetworkClock) Offset() time.Duration {
+	return time.Now().Round(0).Sub(c.Now())
+}
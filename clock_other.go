@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package senbiotpkg
+
+import (
+	"errors"
+	"time"
+)
+
+// SetHostClock is not supported on this platform
+func SetHostClock(t time.Time) error {
+	return errors.New("setting the host clock is not supported on this platform")
+}
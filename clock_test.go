@@ -0,0 +1,41 @@
+package senbiotpkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCCLK(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{`17/11/21,14:03:12+04`, time.Date(2017, 11, 21, 13, 3, 12, 0, time.UTC), false},
+		{`"26/10/19,08:00:00-08"`, time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), false},
+		{`70/01/01,00:00:00+00`, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{`17/11/21,14:03:12`, time.Time{}, true},
+		{`17/13/21,14:03:12+04`, time.Time{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseCCLK(test.value)
+		if (err != nil) != test.err || !got.Equal(test.want) {
+			t.Errorf("ParseCCLK(%q) = %v, %v, want %v", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestCheckNetworkTime(t *testing.T) {
+	defer func(year string) { BuildYear = year }(BuildYear)
+	BuildYear = "2026"
+	if err := checkNetworkTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("time in the build year: %v", err)
+	}
+	if err := checkNetworkTime(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)); err != ErrNoNetworkTime {
+		t.Errorf("time before the build year: %v", err)
+	}
+	BuildYear = "unknown"
+	if err := checkNetworkTime(time.Now()); err == nil {
+		t.Error("invalid build year accepted")
+	}
+}
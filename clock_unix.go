@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package senbiotpkg
+
+import (
+	"syscall"
+	"time"
+)
+
+// SetHostClock sets the clock of the host, which needs root privileges
+func SetHostClock(t time.Time) error {
+	tv := syscall.NsecToTimeval(t.UnixNano())
+	return syscall.Settimeofday(&tv)
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -14,14 +15,25 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 var (
 	portID          = flag.String("portID", "", "serial port to communicate")
-	device          = flag.String("device", "", "Device name to use for command strings, eq ublox01b, ublox02b, quicktel")
-	provider        = flag.String("provider", "", "Provider to connect to, eg, t-mobilenl, vodafone")
+	device          = flag.String("device", "", "Device name to use for command strings, eq ublox01b, ublox02b, quicktel, quicktelbc66, detected from the module when omitted")
+	provider        = flag.String("provider", "", "Provider to connect to, eg, t-mobilenl, vodafone, or auto to choose from the IMSI of the SIM")
 	cfgFile         = flag.String("config", "config.yml", "config-file for the API-settings")
+	output          = flag.String("output", "table", "output format of ScanOperators, table or json")
+	bands           = flag.String("bands", "", "comma-separated bands to measure with ScanOperators, all supported bands when empty")
+	pingAddress     = flag.String("ping-address", "", "address to Ping, the NPING address of the networkinfo in config.yml when empty")
+	pingCount       = flag.Int("ping-count", 4, "number of pings to send")
+	pingInterval    = flag.Duration("ping-interval", time.Second, "time between pings")
+	apply           = flag.Bool("apply", false, "write the settings that differ from the init sequence with ConfigDrift")
+	snapshot        = flag.String("snapshot", "snapshot.yml", "file to write the module settings to with Backup")
+	bandWait        = flag.Duration("band-wait", 30*time.Second, "longest time to wait for a signal on each band")
 	defaultName     = "ublox01b"
 	defaultProvider = "t-mobilenl"
 )
@@ -54,7 +66,7 @@ func (c *command) Set(value string) error {
 var commands command
 
 func main() {
-	flag.Var(&commands, "command", "comma-separated list of commands (ConfigInfo, NetworkInfo, ScanPorts) to use ")
+	flag.Var(&commands, "command", "comma-separated list of commands (ConfigInfo, NetworkInfo, RadioStats, PSMInfo, SIMInfo, ScanOperators, Ping, ConfigDrift, Backup, ScanPorts) to use ")
 	flag.Parse()
 
 	var Usage = func() {
@@ -80,18 +92,6 @@ func main() {
 	var ChosenPort string
 	var ChosenProvider string
 
-	if len(c.Device) == 0 && len(*device) == 0 {
-		fmt.Println("no device name present, please set device see config.yml for devicenames eg ublox01b, ublox02b, quicktel\n")
-		Usage()
-		return
-	} else {
-		if len(*device) != 0 {
-			ChosenDevice = *device
-		} else {
-			ChosenDevice = c.Device
-		}
-	}
-
 	if len(c.PortID) == 0 && len(*portID) == 0 {
 		fmt.Println("no port name present, these are the available ports:\n")
 		senbiotpkg.ScanPorts()
@@ -126,6 +126,20 @@ func main() {
 		senbiotpkg.ScanPorts()
 		log.Fatal("serial port [", ChosenPort, "] can not be opened: ", err)
 	}
+	ChosenDevice = senbiotpkg.ChooseDevice(port, c, *device)
+	if len(ChosenDevice) == 0 {
+		fmt.Println("no device name present, please set device see config.yml for devicenames eg ublox01b, ublox02b, quicktel, quicktelbc66\n")
+		Usage()
+		return
+	}
+	if ChosenProvider == senbiotpkg.AutoProvider {
+		var imsi string
+		ChosenProvider, imsi, err = senbiotpkg.DetectProvider(port, c)
+		if err != nil {
+			log.Fatal("could not choose provider: ", err)
+		}
+		fmt.Printf("provider %s chosen for IMSI %s\n", ChosenProvider, imsi)
+	}
 	var currentSetup senbiotpkg.Setup
 	for _, v := range c.Stps {
 		//fmt.Printf("%d = %s\n", i, v.Provider)
@@ -145,6 +159,28 @@ func main() {
 				senbiotpkg.ConfigInfo(port, currentSetup)
 			case "NetworkInfo":
 				senbiotpkg.NetworkInfo(port, currentSetup)
+			case "PSMInfo":
+				settings, err := senbiotpkg.ReadPSM(port)
+				if err != nil {
+					log.Fatal("could not read power saving mode: ", err)
+				}
+				fmt.Println(settings)
+			case "RadioStats":
+				stats, err := senbiotpkg.ReadRadioStats(port, currentSetup)
+				if err != nil {
+					log.Fatal("could not read radio statistics: ", err)
+				}
+				fmt.Printf("%+v\n", stats)
+			case "SIMInfo":
+				SIMInfo(port)
+			case "ScanOperators":
+				ScanOperators(port, currentSetup)
+			case "Ping":
+				Ping(port, currentSetup)
+			case "ConfigDrift":
+				ConfigDrift(port, currentSetup)
+			case "Backup":
+				Backup(port)
 			case "ScanPorts":
 				senbiotpkg.ScanPorts()
 			}
@@ -156,3 +192,131 @@ func main() {
 		senbiotpkg.NetworkInfo(port, currentSetup)
 	}
 }
+
+// SIMInfo shows the state of the SIM and, when it is ready, its IMSI and ICCID
+func SIMInfo(port serial.Port) {
+	state, err := senbiotpkg.SIMState(port)
+	if err != nil {
+		log.Fatal("could not read SIM state: ", err)
+	}
+	fmt.Printf("SIM state: %s\n", state)
+	if senbiotpkg.CheckSIM(port) != nil {
+		return
+	}
+	if imsi, err := senbiotpkg.ReadIMSI(port); err == nil {
+		fmt.Printf("IMSI: %s\n", imsi)
+	}
+	if iccid, err := senbiotpkg.ReadICCID(port); err == nil {
+		fmt.Printf("ICCID: %s\n", iccid)
+	}
+}
+
+// ScanOperators shows the operators the module can see and the signal on each band
+func ScanOperators(port serial.Port, c senbiotpkg.Setup) {
+	operators, err := senbiotpkg.ScanOperators(port)
+	if err != nil {
+		log.Fatal("could not scan operators: ", err)
+	}
+	var scanBands []int
+	for _, b := range strings.Split(*bands, ",") {
+		if band, err := strconv.Atoi(strings.TrimSpace(b)); err == nil {
+			scanBands = append(scanBands, band)
+		}
+	}
+	measurements, err := senbiotpkg.ScanBands(port, c, scanBands, *bandWait)
+	if err != nil {
+		log.Fatal("could not scan bands: ", err)
+	}
+
+	if *output == "json" {
+		result := struct {
+			Operators []senbiotpkg.Operator        `json:"operators"`
+			Bands     []senbiotpkg.BandMeasurement `json:"bands"`
+		}{operators, measurements}
+		d, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(d))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tOPERATOR\tSHORT\tPLMN\tACT")
+	for _, o := range operators {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", o.StatusName(), o.Long, o.Short, o.Numeric, o.AcT)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "BAND\tRSSI\tSIGNAL POWER\tSNR\tECL\tCELL ID\tERROR")
+	for _, m := range measurements {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\t%s\n", m.Band, m.RSSI, m.Stats.SignalPower, m.Stats.SNR, m.Stats.ECL, m.Stats.CellID, m.Error)
+	}
+	w.Flush()
+}
+
+// Ping pings an address from the module and shows the round trip times
+func Ping(port serial.Port, c senbiotpkg.Setup) {
+	address, quoted := senbiotpkg.PingAddress(c)
+	if len(*pingAddress) != 0 {
+		address = *pingAddress
+	}
+	if len(address) == 0 {
+		log.Fatal("no address to ping, use -ping-address")
+	}
+	fmt.Printf("PING %s\n", address)
+	stats, err := senbiotpkg.PingSeries(port, address, quoted, *pingCount, *pingInterval, func(r senbiotpkg.PingResult) {
+		if r.Err != nil {
+			fmt.Printf("seq=%d %v\n", r.Seq, r.Err)
+		} else {
+			fmt.Printf("reply from %s: seq=%d ttl=%d time=%v\n", r.Address, r.Seq, r.TTL, r.RTT)
+		}
+	})
+	if err != nil {
+		log.Fatal("ping failed: ", err)
+	}
+	fmt.Printf("--- %s ping statistics ---\n%s\n", address, stats)
+}
+
+// ConfigDrift shows the settings of the module that differ from what the init sequence sets, and writes them with -apply
+func ConfigDrift(port serial.Port, c senbiotpkg.Setup) {
+	settings, err := senbiotpkg.ConfigDrift(port, c)
+	if err != nil {
+		log.Fatal("could not read settings: ", err)
+	}
+	var drift int
+	for _, s := range settings {
+		if s.Differs() {
+			drift++
+			fmt.Printf("%s\n- %s\n+ %s\n", s.Name, s.Have, s.Want)
+		}
+	}
+	if drift == 0 {
+		fmt.Println("module settings match the init sequence")
+		return
+	}
+	fmt.Printf("%d of %d settings differ from the init sequence\n", drift, len(settings))
+	if *apply {
+		if err := senbiotpkg.ApplyDrift(port, settings); err != nil {
+			log.Fatal("could not apply settings: ", err)
+		}
+		fmt.Println("settings applied, the radio is off")
+	}
+}
+
+// Backup writes the settings of the module to the -snapshot file
+func Backup(port serial.Port) {
+	s, err := senbiotpkg.ReadSnapshot(port)
+	if err != nil {
+		log.Fatal("could not read settings: ", err)
+	}
+	d, err := yaml.Marshal(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*snapshot, d, 0644); err != nil {
+		log.Fatal("error writing snapshot: ", err)
+	}
+	fmt.Printf("settings of %s written to %s\n", s.Model, *snapshot)
+	if len(s.Missing) != 0 {
+		fmt.Printf("not supported by the module: %s\n", strings.Join(s.Missing, ", "))
+	}
+}
@@ -5,15 +5,31 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"github.com/johanhenselmans/senbiotpkg"
+	"gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
+	"strings"
 )
 
 var (
-	message = flag.String("message", "", "Data to send")
+	message    = flag.String("message", "", "Data to send")
+	formatName = flag.String("format", "raw", "format of the message: "+strings.Join(senbiotpkg.FormatNames(), ", ")+", the others than raw are printed as JSON")
+	schemaFile = flag.String("schema", "", "yaml file with the payload schema of the message, sets the format to the schema")
+	keyFile    = flag.String("key-file", "", "file with the device ids and AES keys to decrypt the message with")
+	replayFile = flag.String("replay-file", "", "file with the message counters received, to refuse a message that was received before")
+	envelope   = flag.Bool("envelope", false, "the message is in an envelope, its sequence number, time and type are shown on stderr")
+	decompress = flag.Bool("decompress", false, "the message is compressed, it is decompressed with the compression of its header byte")
+	device     = flag.String("device", "", "name of the device that sent the messages, needed with -stream and -envelope to follow its sequence numbers, unless the messages are sealed with the device id")
+	output     = flag.String("output", "text", "how to show the payload: text, hexdump, go or c byte array, json with base64, or pretty in its format, detected when -format is raw")
+	stream     = flag.Bool("stream", false, "read many messages from stdin, one per line")
+	codecName  = flag.String("codec", "hex", "encoding of the message: "+strings.Join(senbiotpkg.CodecNames(), ", ")+", or auto to detect it")
 )
 
 type command []string
@@ -37,8 +53,11 @@ func main() {
 	if (pipemessage.Mode()&os.ModeCharDevice) == os.ModeCharDevice && len(*message) == 0 && flag.NFlag() == 0 {
 		Usage()
 		return
-	} else if pipemessage.Size() > 0 {
-		messagebyte, _ = ioutil.ReadAll(os.Stdin)
+	} else if pipemessage.Size() > 0 || (pipemessage.Mode()&os.ModeCharDevice) == 0 && len(*message) == 0 {
+		// a stream is read line by line as it comes in
+		if !*stream {
+			messagebyte, _ = ioutil.ReadAll(os.Stdin)
+		}
 	} else if len(*message) != 0 {
 		//fmt.Printf("%s", *message)
 		//convert string to []byte
@@ -46,6 +65,165 @@ func main() {
 		messageString = *message
 		messagebyte = []byte(messageString)
 	}
-	fmt.Printf("%s", senbiotpkg.DecodeMessageByte(messagebyte))
+	if len(*schemaFile) != 0 {
+		d, err := ioutil.ReadFile(*schemaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var schema senbiotpkg.PayloadSchema
+		if err := yaml.Unmarshal(d, &schema); err != nil {
+			log.Fatal(err)
+		}
+		if err := schema.Validate(); err != nil {
+			log.Fatalf("%s: %v", *schemaFile, err)
+		}
+		senbiotpkg.RegisterFormat(schema)
+		*formatName = schema.Name()
+	}
+	format, err := senbiotpkg.FormatByName(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(*keyFile) != 0 {
+		if keys, err = senbiotpkg.LoadKeys(*keyFile); err != nil {
+			log.Fatal(err)
+		}
+		if len(*replayFile) != 0 {
+			if guard, err = senbiotpkg.LoadReplayGuard(*replayFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
 
+	if !*stream {
+		output, err := decodeMessage(bytes.TrimSpace(messagebyte), format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s", output)
+		return
+	}
+	// one message per line, a message that cannot be decoded is reported
+	// and skipped
+	if *envelope {
+		if len(*device) == 0 && keys == nil {
+			log.Fatal("-stream with -envelope needs -device, or -key-file for sealed messages, to follow the sequence numbers")
+		}
+		tracker = senbiotpkg.NewSequenceTracker()
+	}
+	var input io.Reader = os.Stdin
+	if len(messagebyte) != 0 {
+		input = bytes.NewReader(messagebyte)
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		output, err := decodeMessage(line, format)
+		if err != nil {
+			log.Printf("line %d: %v", n, err)
+			continue
+		}
+		if !bytes.HasSuffix(output, []byte("\n")) {
+			output = append(output, '\n')
+		}
+		fmt.Printf("%s", output)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+}
+
+var (
+	keys    senbiotpkg.Keys
+	guard   *senbiotpkg.ReplayGuard
+	tracker *senbiotpkg.SequenceTracker
+)
+
+// decodeMessage decodes, decrypts, decompresses and unwraps a message and
+// renders the payload as the output flag asks
+func decodeMessage(messagebyte []byte, format senbiotpkg.PayloadFormat) ([]byte, error) {
+	var codec senbiotpkg.Codec
+	var err error
+	if *codecName == "auto" {
+		codec, err = senbiotpkg.DetectCodec(messagebyte)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "detected codec: %s\n", codec.Name())
+		}
+	} else {
+		codec, err = senbiotpkg.CodecByName(*codecName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := codec.Decode(messagebyte)
+	if hexErr, ok := err.(*senbiotpkg.HexError); ok {
+		return nil, fmt.Errorf("%v\n%s", hexErr, hexErr.Marker())
+	}
+	if err != nil {
+		return nil, err
+	}
+	source := *device
+	if keys != nil {
+		var id uint32
+		if id, decoded, err = openPayload(decoded); err != nil {
+			return nil, err
+		}
+		source = fmt.Sprintf("device %d", id)
+	}
+	e, err := senbiotpkg.UnwrapPayload(decoded, *decompress, *envelope)
+	if err != nil {
+		return nil, err
+	}
+	if *decompress {
+		fmt.Fprintf(os.Stderr, "decompressed %d bytes with %s\n", len(decoded), compressionName(decoded[0]))
+	}
+	if *envelope {
+		fmt.Fprintln(os.Stderr, e)
+		if tracker != nil {
+			if r := tracker.Observe(source, e.Sequence); len(r.Missing) != 0 || r.Late || r.Duplicate || r.Restart {
+				fmt.Fprintln(os.Stderr, r)
+			}
+		}
+	}
+	decoded = e.Payload
+	return render(decoded, format)
+}
+
+// compressionName returns the name of the compression with the header byte
+func compressionName(header byte) string {
+	for _, name := range senbiotpkg.CompressionNames() {
+		if c, err := senbiotpkg.CompressionByName(name); err == nil && c.Header() == header {
+			return name
+		}
+	}
+	return fmt.Sprintf("header %#02x", header)
+}
+
+// render shows the payload as the output flag asks
+func render(payload []byte, format senbiotpkg.PayloadFormat) ([]byte, error) {
+	rendered, shown, err := senbiotpkg.RenderPayload(payload, *output, format)
+	if err == nil && shown != format {
+		fmt.Fprintf(os.Stderr, "detected format: %s\n", shown.Name())
+	}
+	return rendered, err
+}
+
+// openPayload decrypts an encrypted payload and checks it was not received before
+func openPayload(sealed []byte) (uint32, []byte, error) {
+	device, counter, payload, err := senbiotpkg.OpenPayload(keys, guard, sealed)
+	if err != nil {
+		return device, nil, fmt.Errorf("message %d of device %d: %v", counter, device, err)
+	}
+	if guard != nil {
+		if err := guard.Save(*replayFile); err != nil {
+			return device, nil, err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "message %d of device %d\n", counter, device)
+	return device, payload, nil
 }
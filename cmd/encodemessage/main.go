@@ -5,15 +5,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/johanhenselmans/senbiotpkg"
+	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"log"
 	"os"
+	"strings"
 )
 
 var (
-	message = flag.String("message", "", "Data to send")
+	message    = flag.String("message", "", "Data to send")
+	formatName = flag.String("format", "raw", "format of the message: "+strings.Join(senbiotpkg.FormatNames(), ", ")+", the others than raw take JSON")
+	size       = flag.Bool("size", false, "report the size of the payload against the JSON message on stderr")
+	schemaFile = flag.String("schema", "", "yaml file with the payload schema of the message, sets the format to the schema")
+	compress   = flag.String("compress", "", "compress the payload with "+strings.Join(senbiotpkg.CompressionNames(), " or "))
+	codecName  = flag.String("codec", "hex", "encoding of the message: "+strings.Join(senbiotpkg.CodecNames(), ", "))
 )
 
 type command []string
@@ -37,7 +47,7 @@ func main() {
 	if (pipemessage.Mode()&os.ModeCharDevice) == os.ModeCharDevice && len(*message) == 0 && flag.NFlag() == 0 {
 		Usage()
 		return
-	} else if pipemessage.Size() > 0 {
+	} else if pipemessage.Size() > 0 || (pipemessage.Mode()&os.ModeCharDevice) == 0 && len(*message) == 0 {
 		messagebyte, _ = ioutil.ReadAll(os.Stdin)
 	} else if len(*message) != 0 {
 		//fmt.Printf("%s", *message)
@@ -46,6 +56,71 @@ func main() {
 		messageString = *message
 		messagebyte = []byte(messageString)
 	}
-	fmt.Printf("%s", senbiotpkg.EncodeMessageByte(messagebyte))
+	if len(*schemaFile) != 0 {
+		d, err := ioutil.ReadFile(*schemaFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var schema senbiotpkg.PayloadSchema
+		if err := yaml.Unmarshal(d, &schema); err != nil {
+			log.Fatal(err)
+		}
+		if err := schema.Validate(); err != nil {
+			log.Fatalf("%s: %v", *schemaFile, err)
+		}
+		senbiotpkg.RegisterFormat(schema)
+		*formatName = schema.Name()
+	}
+	format, err := senbiotpkg.FormatByName(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	payload, err := format.Encode(messagebyte)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *size && format.Name() != "raw" {
+		jsonsize, err := jsonSize(messagebyte, len(*schemaFile) != 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "json %d bytes, %s %d bytes (%.0f%%)\n", jsonsize, format.Name(),
+			len(payload), float64(len(payload))*100/float64(jsonsize))
+	}
+	if len(*compress) != 0 {
+		compression, err := senbiotpkg.CompressionByName(*compress)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if payload, err = senbiotpkg.Compress(compression, payload); err != nil {
+			log.Fatal(err)
+		}
+	}
+	codec, err := senbiotpkg.CodecByName(*codecName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoded, err := codec.Encode(payload)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s", encoded)
+
+}
 
+// jsonSize returns the size of the message as compact JSON. A schema record
+// can also be given as key=value pairs, it is measured as the JSON object of
+// its parsed values then.
+func jsonSize(messagebyte []byte, schema bool) (int, error) {
+	var compact bytes.Buffer
+	err := json.Compact(&compact, messagebyte)
+	if err == nil || !schema {
+		return compact.Len(), err
+	}
+	record, err := senbiotpkg.ParseRecord(messagebyte)
+	if err != nil {
+		return 0, err
+	}
+	d, err := json.Marshal(record)
+	return len(d), err
 }
@@ -14,16 +14,40 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 )
 
 var (
 	portID          = flag.String("portID", "", "serial port to communicate")
-	device          = flag.String("device", "", "Device name to use for command strings, eq ublox01b, ublox02b, quicktel")
-	provider        = flag.String("provider", "", "Provider to connect to, eg, t-mobilenl, vodafone")
+	device          = flag.String("device", "", "Device name to use for command strings, eq ublox01b, ublox02b, quicktel, quicktelbc66, detected from the module when omitted")
+	provider        = flag.String("provider", "", "Provider to connect to, eg, t-mobilenl, vodafone, or auto to choose from the IMSI of the SIM")
 	message         = flag.String("message", "", "Data to send")
 	cfgFile         = flag.String("config", "config.yml", "config-file for the API-settings")
+	envelope        = flag.Bool("envelope", false, "put the message in an envelope with a sequence number")
+	sequenceFile    = flag.String("sequence-file", "", "file with the sequence number of the envelope, next to the config file and named after it and the device by default, eg config-ublox01b.sequence")
+	timestamp       = flag.Bool("timestamp", false, "add the time to the envelope")
+	payloadType     = flag.Int("payload-type", -1, "payload type 0 to 255 to add to the envelope")
+	compress        = flag.String("compress", "", "compress the message with "+strings.Join(senbiotpkg.CompressionNames(), " or "))
+	keyFile         = flag.String("key-file", "", "file with the device id and AES key to encrypt the message with, see LoadKeys")
+	counterFile     = flag.String("counter-file", "", "file with the message counter of the key, the key file with .counter by default")
+	fragment        = flag.Bool("fragment", false, "split a message larger than the transport allows (512 bytes over CDP) in fragments with a header")
+	psmTau          = flag.Duration("psm-tau", 0, "Power saving mode periodic TAU (T3412) to request, eg 24h")
+	psmActive       = flag.Duration("psm-active", 0, "Power saving mode active time (T3324) to request, eg 10s")
+	rebootTimeout   = flag.Duration("reboot-timeout", senbiotpkg.RebootTimeout, "longest time to wait for the device to come up after a reboot")
+	interval        = flag.Duration("interval", 10*time.Second, "time between the samples of a Survey")
+	samples         = flag.Int("samples", 0, "number of Survey samples to take, 0 to go on until interrupted")
+	gpsPort         = flag.String("gps", "", "serial port of an NMEA GPS to tag the Survey samples with")
+	gpsBaud         = flag.Int("gps-baud", 9600, "baud rate of the serial port of the GPS")
+	position        = flag.String("position", "", "fixed position of the Survey as lat,lon, eg 52.0907,5.1214")
+	csvFile         = flag.String("csv", "survey.csv", "CSV file to write the Survey samples to")
+	geojsonFile     = flag.String("geojson", "survey.geojson", "GeoJSON file to write the Survey samples with a position to")
+	setClock        = flag.Bool("set-clock", false, "set the clock of this machine to the network time with NetworkTime, needs root")
+	firmwareFile    = flag.String("firmware", "", "delta firmware package to install with Firmware")
+	snapshot        = flag.String("snapshot", "snapshot.yml", "settings made with checkconfig -command Backup to write with Restore")
+	pinFile         = flag.String("pin-file", "", "file with the SIM PIN, the SENBIOT_PIN environment variable takes precedence")
+	edrx            = flag.Duration("edrx", 0, "eDRX cycle to request, eg 81.92s")
 	defaultName     = "ublox01b"
 	defaultProvider = "t-mobilenl"
 )
@@ -56,7 +80,7 @@ func (c *command) Set(value string) error {
 var commands command
 
 func main() {
-	flag.Var(&commands, "command", "comma-separated list of commands (Reboot, Init, SetupNetwork, WaitForNetwork, ConfigInfo, NetworkInfo, SendMessage, ScanPorts) to use ")
+	flag.Var(&commands, "command", "comma-separated list of commands (Reboot, Init, SetupNetwork, WaitForNetwork, Connect, Survey, NetworkTime, Firmware, Restore, ConfigInfo, NetworkInfo, SendMessage, SetupPSM, PSMInfo, ScanPorts) to use ")
 	flag.Parse()
 
 	var Usage = func() {
@@ -100,18 +124,6 @@ func main() {
 	var ChosenPort string
 	var ChosenProvider string
 
-	if len(c.Device) == 0 && len(*device) == 0 {
-		fmt.Println("no device name present, please set device see config.yml for devicenames eg ublox01b, ublox02b, quicktel\n")
-		Usage()
-		return
-	} else {
-		if len(*device) != 0 {
-			ChosenDevice = *device
-		} else {
-			ChosenDevice = c.Device
-		}
-	}
-
 	if len(c.PortID) == 0 && len(*portID) == 0 {
 		fmt.Println("no port name present, these are the available ports:\n")
 		senbiotpkg.ScanPorts()
@@ -147,6 +159,20 @@ func main() {
 		senbiotpkg.ScanPorts()
 		log.Fatal("serial port [", ChosenPort, "] can not be opened: ", err)
 	}
+	ChosenDevice = senbiotpkg.ChooseDevice(port, c, *device)
+	if len(ChosenDevice) == 0 {
+		fmt.Println("no device name present, please set device see config.yml for devicenames eg ublox01b, ublox02b, quicktel, quicktelbc66\n")
+		Usage()
+		return
+	}
+	if ChosenProvider == senbiotpkg.AutoProvider {
+		var imsi string
+		ChosenProvider, imsi, err = senbiotpkg.DetectProvider(port, c)
+		if err != nil {
+			log.Fatal("could not choose provider: ", err)
+		}
+		fmt.Printf("provider %s chosen for IMSI %s\n", ChosenProvider, imsi)
+	}
 	var currentSetup senbiotpkg.Setup
 	for _, v := range c.Stps {
 		//fmt.Printf("%d = %s\n", i, v.Provider)
@@ -173,28 +199,46 @@ func main() {
 			case "SetupNetwork":
 				SetupNetwork(port, currentSetup)
 			case "SendMessage":
+				CheckSIM(port)
 				SendMsgs(port, currentSetup, messagebyte)
 			case "WaitForNetwork":
 				WaitForNetwork(port, currentSetup)
+			case "Connect":
+				Connect(port, currentSetup)
+			case "Survey":
+				Survey(port, currentSetup)
+			case "NetworkTime":
+				NetworkTime(port)
+			case "Firmware":
+				Firmware(port)
+			case "Restore":
+				Restore(port, currentSetup)
+			case "SetupPSM":
+				SetupPowerSaving(port)
+			case "PSMInfo":
+				PSMInfo(port)
 			case "ScanPorts":
 				senbiotpkg.ScanPorts()
 			}
 		}
 	} else {
 		// we assume the device has already been setup
-		SetupNetwork(port, currentSetup)
-		WaitForNetwork(port, currentSetup)
+		if *psmTau != 0 || *psmActive != 0 || *edrx != 0 {
+			SetupPowerSaving(port)
+		}
+		Connect(port, currentSetup)
 		SendMsgs(port, currentSetup, messagebyte)
 	}
 }
 
-// rebootDevice reboots the device and waits 7 seconds for it to come up
+// rebootDevice reboots the device and waits until it is ready again
 func RebootDevice(port serial.Port, c senbiotpkg.Setup) {
-	for _, v := range c.Reboot {
-		senbiotpkg.ReadWritePort(port, v)
+	bootTime, err := senbiotpkg.RebootDevice(port, c, *rebootTimeout)
+	if err != nil {
+		log.Fatal("device did not come up after reboot: ", err)
 	}
-	const delay = 7000 * time.Millisecond
-	time.Sleep(delay)
+	simReady = false
+	fmt.Printf("device ready after %v\n", bootTime)
 }
 
 //the init section of the yaml page of the device with answers is run, stored in nv memory, has to be run only once
@@ -202,15 +246,171 @@ func SetupInit(port serial.Port, c senbiotpkg.Setup) {
 	for _, v := range c.Init {
 		senbiotpkg.ReadWritePort(port, v)
 	}
+	// the init sequence reboots the device
+	simReady = false
 }
 
 func SetupNetwork(port serial.Port, c senbiotpkg.Setup) {
+	CheckSIM(port)
 	for _, v := range c.SetupNetwork {
 		senbiotpkg.ReadWritePort(port, v)
 	}
 }
 
+// Connect brings the network connection up, recovering when it gets stuck, and shows the state transitions
+func Connect(port serial.Port, c senbiotpkg.Setup) {
+	pin, err := senbiotpkg.LoadPIN(*pinFile)
+	if err != nil {
+		log.Fatal("could not read SIM PIN: ", err)
+	}
+	connection := senbiotpkg.NewConnection(port, c)
+	connection.PIN = pin
+	err = connection.Connect()
+	for _, t := range connection.History() {
+		fmt.Println(t)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	simReady = true
+}
+
+// Survey samples the signal and cell at every interval and writes them to the CSV and GeoJSON files
+func Survey(port serial.Port, c senbiotpkg.Setup) {
+	var pos senbiotpkg.PositionSource
+	if len(*gpsPort) != 0 {
+		gps, err := serial.Open(*gpsPort, &serial.Mode{BaudRate: *gpsBaud})
+		if err != nil {
+			log.Fatal("GPS port [", *gpsPort, "] can not be opened: ", err)
+		}
+		defer gps.Close()
+		pos = senbiotpkg.NewNMEAPosition(gps)
+	} else if len(*position) != 0 {
+		var p senbiotpkg.FixedPosition
+		if _, err := fmt.Sscanf(*position, "%f,%f", &p.Lat, &p.Lon); err != nil {
+			log.Fatal("position should be lat,lon: ", err)
+		}
+		pos = p
+	}
+
+	f, err := os.Create(*csvFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	csv := senbiotpkg.NewSurveyCSV(f)
+	g, err := os.Create(*geojsonFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer g.Close()
+	geojson := senbiotpkg.NewSurveyGeoJSON(g)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	var taken int
+	for {
+		sample, err := senbiotpkg.TakeSample(port, c, pos)
+		if err != nil {
+			fmt.Println("sample failed: ", err)
+		} else {
+			taken++
+			fmt.Printf("%s rssi: %d signal power: %d cell: %s\n", sample.Time.Format(time.RFC3339), sample.RSSI, sample.Stats.SignalPower, sample.Registration.CellID)
+			if err := csv.Write(sample); err != nil {
+				log.Fatal(err)
+			}
+			if err := geojson.Write(sample); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *samples != 0 && taken >= *samples {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// NetworkTime shows the network time and how far the clock of this machine is off, and sets the clock with -set-clock
+func NetworkTime(port serial.Port) {
+	clock, err := senbiotpkg.SyncNetworkClock(port)
+	if err != nil {
+		log.Fatal("could not read network time: ", err)
+	}
+	fmt.Printf("network time: %s, this machine is %v ahead\n", clock.Now().Format(time.RFC3339), clock.Offset())
+	if *setClock {
+		if err := senbiotpkg.SetHostClock(clock.Now()); err != nil {
+			log.Fatal("could not set clock: ", err)
+		}
+		fmt.Println("clock set to network time")
+	}
+}
+
+// Firmware installs the -firmware delta package on the module and shows the version before and after
+func Firmware(port serial.Port) {
+	if len(*firmwareFile) == 0 {
+		log.Fatal("no firmware package, use -firmware")
+	}
+	firmware, err := ioutil.ReadFile(*firmwareFile)
+	if err != nil {
+		log.Fatal("error reading firmware package: ", err)
+	}
+	version, err := senbiotpkg.FirmwareVersion(port)
+	if err != nil {
+		log.Fatal("could not read firmware version: ", err)
+	}
+	fmt.Printf("current firmware: %s\n", version)
+	version, err = senbiotpkg.UpdateFirmware(port, firmware, version, func(sent, total int) {
+		fmt.Printf("\rsent %d of %d bytes (%d%%)", sent, total, sent*100/total)
+	})
+	fmt.Println()
+	if err != nil {
+		log.Fatal("firmware update failed: ", err)
+	}
+	simReady = false
+	fmt.Printf("new firmware: %s\n", version)
+}
+
+// Restore writes the settings of the -snapshot file to the module
+func Restore(port serial.Port, c senbiotpkg.Setup) {
+	d, err := ioutil.ReadFile(*snapshot)
+	if err != nil {
+		log.Fatal("error reading snapshot: ", err)
+	}
+	var s senbiotpkg.Snapshot
+	if err := yaml.Unmarshal(d, &s); err != nil {
+		log.Fatal("reading snapshot failed: ", err)
+	}
+	if err := senbiotpkg.RestoreSnapshot(port, s, c); err != nil {
+		log.Fatal("could not restore snapshot: ", err)
+	}
+	fmt.Printf("settings of %s restored from %s\n", s.Model, *snapshot)
+}
+
+// simReady is set once the SIM was checked, the SIM is checked again after a reboot
+var simReady bool
+
+// CheckSIM stops when the SIM is missing or locked, a PIN is entered when one is available.
+// The SIM is checked once per run, a reboot locks it again.
+func CheckSIM(port serial.Port) {
+	if simReady {
+		return
+	}
+	pin, err := senbiotpkg.LoadPIN(*pinFile)
+	if err != nil {
+		log.Fatal("could not read SIM PIN: ", err)
+	}
+	if err := senbiotpkg.EnableSIM(port, pin); err != nil {
+		log.Fatal("SIM is not ready: ", err)
+	}
+	simReady = true
+}
+
 func WaitForNetwork(port serial.Port, c senbiotpkg.Setup) string {
+	CheckSIM(port)
 	var result string
 	for _, v := range c.WaitForNetwork {
 		var i int
@@ -235,8 +435,47 @@ func WaitForNetwork(port serial.Port, c senbiotpkg.Setup) string {
 
 //the messages section is run, with answers to be expected
 func SendMsgs(port serial.Port, c senbiotpkg.Setup, messagebyte []byte) {
-	dst := senbiotpkg.EncodeMessageByte(messagebyte)
-	sendString := fmt.Sprintf("%s%d,%s\r\n", c.SendMessageString, len(dst), dst)
+	opts := senbiotpkg.PayloadOptions{
+		Envelope:     *envelope,
+		SequenceFile: *sequenceFile,
+		Timestamp:    *timestamp,
+		Compress:     *compress,
+		KeyFile:      *keyFile,
+		CounterFile:  *counterFile,
+		Fragment:     *fragment,
+		Log:          os.Stdout,
+	}
+	if *payloadType >= 0 {
+		if *payloadType > 255 {
+			log.Fatal("payload type is 0 to 255")
+		}
+		opts.Type, opts.HasType = uint8(*payloadType), true
+	}
+	if len(opts.SequenceFile) == 0 {
+		opts.SequenceFile = senbiotpkg.SequenceFile(*cfgFile, c.Setup)
+	}
+	payloads, err := senbiotpkg.PreparePayload(c, messagebyte, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, payload := range payloads {
+		if len(payloads) > 1 {
+			fmt.Printf("Fragment %d of %d\n", i+1, len(payloads))
+		}
+		SendMsg(port, c, payload)
+	}
+}
+
+// SendMsg sends a single message that fits the transport
+func SendMsg(port serial.Port, c senbiotpkg.Setup, messagebyte []byte) {
+	if modem, err := senbiotpkg.NewModem(port, c); err == nil {
+		if err := modem.Send(messagebyte); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Sent %v bytes\n", len(messagebyte))
+		return
+	}
+	sendString := senbiotpkg.SendRequest(c, messagebyte) + "\r\n"
 	fmt.Println(sendString)
 	n, err := port.Write([]byte(sendString))
 	if err != nil {
@@ -246,3 +485,27 @@ func SendMsgs(port serial.Port, c senbiotpkg.Setup, messagebyte []byte) {
 	senbiotpkg.ReadResponse(port)
 
 }
+
+// SetupPowerSaving requests the PSM and eDRX timers given on the commandline
+func SetupPowerSaving(port serial.Port) {
+	if *psmTau != 0 || *psmActive != 0 {
+		if err := senbiotpkg.SetupPSM(port, *psmTau, *psmActive); err != nil {
+			log.Fatal("could not set power saving mode: ", err)
+		}
+	}
+	if *edrx != 0 {
+		if err := senbiotpkg.SetupEDRX(port, *edrx); err != nil {
+			log.Fatal("could not set eDRX: ", err)
+		}
+	}
+	PSMInfo(port)
+}
+
+// PSMInfo shows the PSM and eDRX timers granted by the network
+func PSMInfo(port serial.Port) {
+	settings, err := senbiotpkg.ReadPSM(port)
+	if err != nil {
+		log.Fatal("could not read power saving mode: ", err)
+	}
+	fmt.Println(settings)
+}
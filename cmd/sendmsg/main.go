@@ -13,14 +13,24 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 )
 
 var (
 	portID          = flag.String("portID", "", "serial port to communicate")
-	device          = flag.String("device", "", "Device name to use for command strings, eq ublox01b, ublox02b, quicktel")
-	provider        = flag.String("provider", "", "Provider to connect to, eg, t-mobilenl, vodafone")
+	device          = flag.String("device", "", "Device name to use for command strings, eq ublox01b, ublox02b, quicktel, quicktelbc66, detected from the module when omitted")
+	provider        = flag.String("provider", "", "Provider to connect to, eg, t-mobilenl, vodafone, or auto to choose from the IMSI of the SIM")
 	message         = flag.String("message", "", "Data to send")
 	cfgFile         = flag.String("config", "config.yml", "config-file for the API-settings")
+	envelope        = flag.Bool("envelope", false, "put the message in an envelope with a sequence number")
+	sequenceFile    = flag.String("sequence-file", "", "file with the sequence number of the envelope, next to the config file and named after it and the device by default, eg config-ublox01b.sequence")
+	timestamp       = flag.Bool("timestamp", false, "add the time to the envelope")
+	payloadType     = flag.Int("payload-type", -1, "payload type 0 to 255 to add to the envelope")
+	compress        = flag.String("compress", "", "compress the message with "+strings.Join(senbiotpkg.CompressionNames(), " or "))
+	keyFile         = flag.String("key-file", "", "file with the device id and AES key to encrypt the message with, see LoadKeys")
+	counterFile     = flag.String("counter-file", "", "file with the message counter of the key, the key file with .counter by default")
+	pinFile         = flag.String("pin-file", "", "file with the SIM PIN, the SENBIOT_PIN environment variable takes precedence")
+	fragment        = flag.Bool("fragment", false, "split a message larger than the transport allows (512 bytes over CDP) in fragments with a header")
 	defaultName     = "ublox01b"
 	defaultProvider = "t-mobilenl"
 )
@@ -69,18 +79,6 @@ func main() {
 	var ChosenPort string
 	var ChosenProvider string
 
-	if len(c.Device) == 0 && len(*device) == 0 {
-		fmt.Println("no device name present, please set device see config.yml for devicenames eg ublox01b, ublox02b, quicktel\n")
-		Usage()
-		return
-	} else {
-		if len(*device) != 0 {
-			ChosenDevice = *device
-		} else {
-			ChosenDevice = c.Device
-		}
-	}
-
 	if len(c.PortID) == 0 && len(*portID) == 0 {
 		fmt.Println("no port name present, these are the available ports:\n")
 		senbiotpkg.ScanPorts()
@@ -117,6 +115,20 @@ func main() {
 		log.Fatal("serial port [", ChosenPort, "] can not be opened: ", err)
 	}
 
+	ChosenDevice = senbiotpkg.ChooseDevice(port, c, *device)
+	if len(ChosenDevice) == 0 {
+		fmt.Println("no device name present, please set device see config.yml for devicenames eg ublox01b, ublox02b, quicktel, quicktelbc66\n")
+		Usage()
+		return
+	}
+	if ChosenProvider == senbiotpkg.AutoProvider {
+		var imsi string
+		ChosenProvider, imsi, err = senbiotpkg.DetectProvider(port, c)
+		if err != nil {
+			log.Fatal("could not choose provider: ", err)
+		}
+		fmt.Printf("provider %s chosen for IMSI %s\n", ChosenProvider, imsi)
+	}
 	var currentSetup senbiotpkg.Setup
 	for _, v := range c.Stps {
 		//fmt.Printf("%d = %s\n", i, v.Provider)
@@ -129,13 +141,64 @@ func main() {
 		log.Fatal("could not find setup for device ", ChosenDevice, " for provider ", ChosenProvider)
 	}
 	// we assume the device has already been setup and a connection has been made
+	CheckSIM(port)
 	SendMsgs(port, currentSetup, messagebyte)
 }
 
+// CheckSIM stops when the SIM is missing or locked, a PIN is entered when one is available
+func CheckSIM(port serial.Port) {
+	pin, err := senbiotpkg.LoadPIN(*pinFile)
+	if err != nil {
+		log.Fatal("could not read SIM PIN: ", err)
+	}
+	if err := senbiotpkg.EnableSIM(port, pin); err != nil {
+		log.Fatal("SIM is not ready: ", err)
+	}
+}
+
 //the messages section is run, with answers to be expected
 func SendMsgs(port serial.Port, c senbiotpkg.Setup, messagebyte []byte) {
-	dst := senbiotpkg.EncodeMessageByte(messagebyte)
-	sendString := fmt.Sprintf("%s%d,%s\r\n", c.SendMessageString, len(dst), dst)
+	opts := senbiotpkg.PayloadOptions{
+		Envelope:     *envelope,
+		SequenceFile: *sequenceFile,
+		Timestamp:    *timestamp,
+		Compress:     *compress,
+		KeyFile:      *keyFile,
+		CounterFile:  *counterFile,
+		Fragment:     *fragment,
+		Log:          os.Stdout,
+	}
+	if *payloadType >= 0 {
+		if *payloadType > 255 {
+			log.Fatal("payload type is 0 to 255")
+		}
+		opts.Type, opts.HasType = uint8(*payloadType), true
+	}
+	if len(opts.SequenceFile) == 0 {
+		opts.SequenceFile = senbiotpkg.SequenceFile(*cfgFile, c.Setup)
+	}
+	payloads, err := senbiotpkg.PreparePayload(c, messagebyte, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, payload := range payloads {
+		if len(payloads) > 1 {
+			fmt.Printf("Fragment %d of %d\n", i+1, len(payloads))
+		}
+		SendMsg(port, c, payload)
+	}
+}
+
+// SendMsg sends a single message that fits the transport
+func SendMsg(port serial.Port, c senbiotpkg.Setup, messagebyte []byte) {
+	if modem, err := senbiotpkg.NewModem(port, c); err == nil {
+		if err := modem.Send(messagebyte); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Sent %v bytes\n", len(messagebyte))
+		return
+	}
+	sendString := senbiotpkg.SendRequest(c, messagebyte) + "\r\n"
 	fmt.Println(sendString)
 	n, err := port.Write([]byte(sendString))
 	if err != nil {
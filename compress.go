@@ -0,0 +1,267 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// A compressed payload starts with the header byte of its compression, so
+// the receiving side can decompress it without knowing how it was sent.
+
+// Compression compresses payloads before they are encoded
+type Compression interface {
+	Name() string
+	// Header is the first byte of a payload with this compression
+	Header() byte
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+var (
+	compressionsMu sync.Mutex
+	compressions   []Compression
+)
+
+// RegisterCompression makes a compression available by its name and header byte
+func RegisterCompression(c Compression) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	compressions = append(compressions, c)
+}
+
+// CompressionByName returns the registered compression with the given name
+func CompressionByName(name string) (Compression, error) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	for _, c := range compressions {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown compression %s", name)
+}
+
+// CompressionNames returns the names of the registered compressions
+func CompressionNames() []string {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	names := make([]string, len(compressions))
+	for i, c := range compressions {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// Compress compresses the payload and puts the header byte in front
+func Compress(c Compression, payload []byte) ([]byte, error) {
+	compressed, err := c.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{c.Header()}, compressed...), nil
+}
+
+// Decompress decompresses a payload that starts with the header byte of a
+// registered compression. Other payloads are returned unchanged, as is a
+// payload that only looks compressed: the compressions fail unless all of
+// the payload is used and, for lz, the length matches.
+func Decompress(payload []byte) ([]byte, bool) {
+	if len(payload) == 0 {
+		return payload, false
+	}
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	for _, c := range compressions {
+		if c.Header() != payload[0] {
+			continue
+		}
+		if d, err := c.Decompress(payload[1:]); err == nil {
+			return d, true
+		}
+	}
+	return payload, false
+}
+
+// DecompressPayload decompresses a payload that is known to be compressed,
+// with the compression of its header byte. Unlike Decompress it returns an
+// error for a payload that does not decompress.
+func DecompressPayload(payload []byte) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload is not compressed")
+	}
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+	for _, c := range compressions {
+		if c.Header() != payload[0] {
+			continue
+		}
+		d, err := c.Decompress(payload[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Name(), err)
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("payload starts with %#02x, which is not the header byte of a compression", payload[0])
+}
+
+func init() {
+	RegisterCompression(deflateCompression{})
+	RegisterCompression(lzCompression{})
+}
+
+// DeflateDictionary is the preset dictionary of the deflate compression. Both
+// sides need the same dictionary, it is best filled with text the messages
+// have in common.
+var DeflateDictionary = []byte("debug info warning error critical sensor temperature humidity pressure " +
+	"battery voltage signal rssi status connected disconnected timeout restart reboot value ok true false " +
+	"\"name\":\"value\":\"time\":")
+
+// deflateCompression is raw deflate with DeflateDictionary
+type deflateCompression struct{}
+
+func (deflateCompression) Name() string { return "deflate" }
+func (deflateCompression) Header() byte { return 0xd0 }
+
+func (deflateCompression) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, DeflateDictionary)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCompression) Decompress(src []byte) ([]byte, error) {
+	br := bytes.NewReader(src)
+	r := flate.NewReaderDict(br, DeflateDictionary)
+	defer r.Close()
+	dst, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// flate reads a bytes.Reader byte by byte, so what is left follows the last block
+	if br.Len() != 0 {
+		return nil, fmt.Errorf("deflate: %d bytes after the compressed data", br.Len())
+	}
+	return dst, nil
+}
+
+// LZ compression, simple enough to decompress on a microcontroller with a
+// window of LZWindow bytes. The data starts with the length of the
+// uncompressed data (2 bytes, big endian), followed by a row of tokens:
+//
+//	0lllllll             literal run of l+1 bytes, which follow
+//	1lllllll oooo oooo   copy l+3 bytes from offset o back (2 bytes, big endian)
+const (
+	LZWindow   = 4096
+	lzMinMatch = 3
+	lzMaxMatch = 0x7f + lzMinMatch
+	lzMaxRun   = 0x80
+)
+
+type lzCompression struct{}
+
+func (lzCompression) Name() string { return "lz" }
+func (lzCompression) Header() byte { return 0xd1 }
+
+func (lzCompression) Compress(src []byte) ([]byte, error) {
+	if len(src) > 0xffff {
+		return nil, fmt.Errorf("lz: %d bytes is more than the 65535 the length allows", len(src))
+	}
+	dst := []byte{byte(len(src) >> 8), byte(len(src))}
+	literals := 0
+	emitLiterals := func(end int) {
+		for literals > 0 {
+			n := literals
+			if n > lzMaxRun {
+				n = lzMaxRun
+			}
+			start := end - literals
+			dst = append(dst, byte(n-1))
+			dst = append(dst, src[start:start+n]...)
+			literals -= n
+		}
+	}
+	// last position of each 3 byte prefix
+	last := make(map[[3]byte]int)
+	for i := 0; i < len(src); {
+		length, offset := 0, 0
+		if i+lzMinMatch <= len(src) {
+			key := [3]byte{src[i], src[i+1], src[i+2]}
+			if j, ok := last[key]; ok && i-j <= LZWindow {
+				for length < lzMaxMatch && i+length < len(src) && src[j+length] == src[i+length] {
+					length++
+				}
+				offset = i - j
+			}
+			last[key] = i
+		}
+		if length < lzMinMatch {
+			literals++
+			i++
+			continue
+		}
+		emitLiterals(i)
+		dst = append(dst, 0x80|byte(length-lzMinMatch), byte(offset>>8), byte(offset))
+		for k := i + 1; k < i+length && k+lzMinMatch <= len(src); k++ {
+			last[[3]byte{src[k], src[k+1], src[k+2]}] = k
+		}
+		i += length
+	}
+	emitLiterals(len(src))
+	return dst, nil
+}
+
+var errLZCorrupt = errors.New("lz: corrupt data")
+
+func (lzCompression) Decompress(src []byte) ([]byte, error) {
+	if len(src) < 2 {
+		return nil, errLZCorrupt
+	}
+	size := int(src[0])<<8 | int(src[1])
+	dst := make([]byte, 0, size)
+	for i := 2; i < len(src); {
+		token := src[i]
+		i++
+		if token&0x80 == 0 {
+			n := int(token) + 1
+			if i+n > len(src) {
+				return nil, errLZCorrupt
+			}
+			dst = append(dst, src[i:i+n]...)
+			i += n
+			continue
+		}
+		if i+2 > len(src) {
+			return nil, errLZCorrupt
+		}
+		length := int(token&0x7f) + lzMinMatch
+		offset := int(src[i])<<8 | int(src[i+1])
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZCorrupt
+		}
+		// byte by byte, the copy may overlap what it writes
+		start := len(dst) - offset
+		for k := 0; k < length; k++ {
+			dst = append(dst, dst[start+k])
+		}
+		if len(dst) > size {
+			return nil, errLZCorrupt
+		}
+	}
+	if len(dst) != size {
+		return nil, fmt.Errorf("lz: %d bytes decompressed instead of %d", len(dst), size)
+	}
+	return dst, nil
+}
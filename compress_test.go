@@ -0,0 +1,112 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	messages := [][]byte{
+		{},
+		[]byte("a"),
+		[]byte("abcabcabcabcabcabcabcabcabcabc"),
+		[]byte(strings.Repeat("info sensor temperature 21.5 humidity 40 ", 20)),
+		bytes.Repeat([]byte{0}, 1000),
+		[]byte(strings.Repeat("x", 300)),
+	}
+	var random []byte
+	for i := 0; i < 2000; i++ {
+		random = append(random, byte(i*7919>>3))
+	}
+	messages = append(messages, random)
+	for _, name := range CompressionNames() {
+		c, err := CompressionByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, message := range messages {
+			compressed, err := Compress(c, message)
+			if err != nil {
+				t.Errorf("%s: Compress(%d bytes): %v", name, len(message), err)
+				continue
+			}
+			if compressed[0] != c.Header() {
+				t.Errorf("%s: header %#02x, want %#02x", name, compressed[0], c.Header())
+			}
+			got, ok := Decompress(compressed)
+			if !ok || !bytes.Equal(got, message) {
+				t.Errorf("%s: round trip of %d bytes gave %d bytes, decompressed %v", name, len(message), len(got), ok)
+			}
+		}
+	}
+}
+
+func TestLZCompress(t *testing.T) {
+	tests := []struct {
+		message    string
+		compressed string
+	}{
+		{"", "d10000"},
+		{"abc", "d10003" + "02616263"},
+		{"abcabcabc", "d10009" + "02616263" + "830003"},
+	}
+	c, _ := CompressionByName("lz")
+	for _, test := range tests {
+		compressed, err := Compress(c, []byte(test.message))
+		if err != nil {
+			t.Errorf("Compress(%q): %v", test.message, err)
+			continue
+		}
+		if got := hex.EncodeToString(compressed); got != test.compressed {
+			t.Errorf("Compress(%q) = %s, want %s", test.message, got, test.compressed)
+		}
+	}
+	if _, err := c.Compress(make([]byte, 0x10000)); err == nil {
+		t.Error("Compress of 65536 bytes succeeded")
+	}
+}
+
+func TestDecompressLeavesUncompressed(t *testing.T) {
+	tests := []string{
+		"",
+		"676f",
+		// starts with the lz header, an LPP temperature would decompress
+		// to 67 01 10 without the length
+		"d102670110",
+		// length 5, but 3 bytes follow
+		"d10005" + "02616263",
+		// length 3, but the data continues
+		"d10003" + "02616263" + "00ff",
+		// copy before the start
+		"d10006" + "00618000" + "05",
+		"d1",
+		"d000",
+		// deflate followed by more bytes
+		"d0" + "4b4c4a0600" + "ff",
+	}
+	for _, test := range tests {
+		payload, _ := hex.DecodeString(test)
+		got, ok := Decompress(payload)
+		if ok || !bytes.Equal(got, payload) {
+			t.Errorf("Decompress(%s) = %x, %v, want it unchanged", test, got, ok)
+		}
+	}
+}
+
+func TestDecompressPayload(t *testing.T) {
+	lz, _ := CompressionByName("lz")
+	compressed, err := Compress(lz, []byte("abcabcabc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecompressPayload(compressed); err != nil || string(got) != "abcabcabc" {
+		t.Errorf("DecompressPayload = %q, %v", got, err)
+	}
+	for _, payload := range []string{"", "48656c6c6f", "d10005ff", "d0ffff"} {
+		if got, err := DecompressPayload(unhex(t, payload)); err == nil {
+			t.Errorf("DecompressPayload(%s) = %x, want an error", payload, got)
+		}
+	}
+}
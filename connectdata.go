@@ -12,6 +12,8 @@ type Setups struct {
 	Provider string  `yaml:"provider"`
 	PortID   string  `yaml:"portID"`
 	Stps     []Setup `yaml:"setups"`
+	// Providers map the IMSI of a SIM to a provider name
+	Providers []Provider `yaml:"providers"`
 }
 
 // Setup struct has the complete sequence of commands
@@ -19,6 +21,7 @@ type Setup struct {
 	Setup             string            `yaml:"setup"`
 	Date              string            `yaml:"date"`
 	Provider          string            `yaml:"provider"`
+	Match             DeviceMatch       `yaml:"match"`
 	Reboot            []RequestResponse `yaml:"reboot"`
 	Init              []RequestResponse `yaml:"init"`
 	SetupNetwork      []RequestResponse `yaml:"setupnetwork"`
@@ -26,6 +29,7 @@ type Setup struct {
 	ConfigInfo        []RequestResponse `yaml:"configinfo"`
 	NetworkInfo       []RequestResponse `yaml:"networkinfo"`
 	GetMsgResponse    []RequestResponse `yaml:"getmsgresponse"`
+	RadioStatsRequest string            `yaml:"radiostatsrequest,omitempty"`
 	SendMessageString string            `yaml:"sendmesssagestring"`
 }
 
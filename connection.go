@@ -0,0 +1,300 @@
+package senbiotpkg
+
+import (
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnectionState is a step in bringing up the network connection
+type ConnectionState int
+
+const (
+	StateRadioOff ConnectionState = iota
+	StateSIMReady
+	StateSearching
+	StateRegistered
+	StateAttached
+	StateReady
+)
+
+var stateNames = []string{"radio off", "SIM ready", "searching", "registered", "attached", "ready to send"}
+
+func (s ConnectionState) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return "state " + strconv.Itoa(int(s))
+}
+
+// Recovery is the action taken when the connection does not come up
+type Recovery int
+
+const (
+	RecoverNone Recovery = iota
+	RecoverCOPS
+	RecoverCFUN
+	RecoverReboot
+)
+
+var recoveryNames = []string{"none", "repeat COPS", "CFUN cycle", "reboot"}
+
+func (r Recovery) String() string {
+	if int(r) < len(recoveryNames) {
+		return recoveryNames[r]
+	}
+	return "recovery " + strconv.Itoa(int(r))
+}
+
+// Transition is a change of the connection state
+type Transition struct {
+	From   ConnectionState
+	To     ConnectionState
+	At     time.Time
+	Reason string
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%s %s -> %s: %s", t.At.Format(time.RFC3339), t.From, t.To, t.Reason)
+}
+
+// Connection brings a module from radio off to ready to send and recovers,
+// by repeating COPS, cycling CFUN and finally rebooting, when it gets stuck
+type Connection struct {
+	// PIN unlocks the SIM when it asks for one
+	PIN string
+	// Polls is how often the registration and attachment are polled before recovering
+	Polls int
+	// PollInterval is the time between polls
+	PollInterval time.Duration
+	// MaxRecovery is the last recovery tried before giving up
+	MaxRecovery Recovery
+
+	port    serial.Port
+	setup   Setup
+	mu      sync.Mutex
+	state   ConnectionState
+	history []Transition
+}
+
+// NewConnection returns a connection manager for the module on port
+func NewConnection(port serial.Port, c Setup) *Connection {
+	return &Connection{
+		Polls:        30,
+		PollInterval: 2 * time.Second,
+		MaxRecovery:  RecoverReboot,
+		port:         port,
+		setup:        c,
+	}
+}
+
+// State returns the current connection state
+func (c *Connection) State() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// History returns the state transitions so far
+func (c *Connection) History() []Transition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Transition(nil), c.history...)
+}
+
+func (c *Connection) setState(s ConnectionState, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s == c.state {
+		return
+	}
+	c.history = append(c.history, Transition{From: c.state, To: s, At: time.Now(), Reason: reason})
+	c.state = s
+}
+
+// HandleURC updates the state from a +CEREG or +CSCON unsolicited result
+// and reports whether the line was one of these
+func (c *Connection) HandleURC(line string) bool {
+	switch {
+	case strings.HasPrefix(line, "+CEREG:"):
+		if reg, err := ParseCEREG(strings.TrimPrefix(line, "+CEREG:"), false); err == nil {
+			c.registration(reg.Stat)
+		}
+		return true
+	case strings.HasPrefix(line, "+CSCON:"):
+		params := splitParams(strings.TrimPrefix(line, "+CSCON:"))
+		mode := params[len(params)-1]
+		if mode == "1" {
+			c.addNote("RRC connected")
+		} else {
+			c.addNote("RRC idle")
+		}
+		return true
+	}
+	return false
+}
+
+// registration moves the state along with the <stat> of +CEREG, 1 is home and 5 roaming
+func (c *Connection) registration(stat int) {
+	registered := stat == 1 || stat == 5
+	state := c.State()
+	switch {
+	case registered && state < StateRegistered:
+		c.setState(StateRegistered, fmt.Sprintf("CEREG stat %d", stat))
+	case !registered && state >= StateRegistered:
+		c.setState(StateSearching, fmt.Sprintf("CEREG stat %d", stat))
+	}
+}
+
+func (c *Connection) addNote(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history = append(c.history, Transition{From: c.state, To: c.state, At: time.Now(), Reason: reason})
+}
+
+// NonRecoverableError is a connection failure that no recovery can fix,
+// such as a missing SIM, a SIM that asks for the PUK or a rejected PIN
+type NonRecoverableError struct {
+	Err error
+}
+
+func (e *NonRecoverableError) Error() string {
+	return "not recoverable: " + e.Err.Error()
+}
+
+// simNotUsable reports whether a PrepareSIM error needs someone to fix the
+// SIM or its PIN. Other errors, such as a timeout, are left to the recovery.
+func simNotUsable(err error) bool {
+	if _, ok := err.(*PINRejectedError); ok {
+		return true
+	}
+	return err == ErrSIMNotInserted || err == ErrPUKRequired || err == ErrPINRequired
+}
+
+// Connect brings the connection up, escalating the recovery after each
+// failure. It stops at once with a *NonRecoverableError when the SIM is
+// missing, asks for the PUK, asks for a PIN that is not given or rejects it.
+func (c *Connection) Connect() error {
+	var err error
+	for recovery := RecoverNone; recovery <= c.MaxRecovery; recovery++ {
+		if recovery != RecoverNone {
+			c.addNote("recovery: " + recovery.String())
+			if err := c.recover(recovery); err != nil {
+				c.setState(StateRadioOff, err.Error())
+				continue
+			}
+		}
+		if err = c.bringUp(); err == nil {
+			return nil
+		}
+		c.addNote(err.Error())
+		if _, ok := err.(*NonRecoverableError); ok {
+			return err
+		}
+	}
+	return fmt.Errorf("connection failed in state %s: %v", c.State(), err)
+}
+
+func (c *Connection) bringUp() error {
+	if _, err := SendCommand(c.port, "AT+CFUN=1", DefaultTimeout); err != nil {
+		return err
+	}
+	if err := PrepareSIM(c.port, c.PIN); err != nil {
+		if !simNotUsable(err) {
+			return err
+		}
+		c.setState(StateRadioOff, err.Error())
+		return &NonRecoverableError{err}
+	}
+	if c.State() < StateSIMReady {
+		c.setState(StateSIMReady, "SIM ready")
+	}
+	// report registration and connection changes
+	if _, err := SendCommand(c.port, "AT+CEREG=1", DefaultTimeout); err != nil {
+		return err
+	}
+	if _, err := SendCommand(c.port, "AT+CSCON=1", DefaultTimeout); err != nil {
+		return err
+	}
+	if c.State() < StateSearching {
+		if err := RunSequence(c.port, c.setup.SetupNetwork); err != nil {
+			return err
+		}
+		c.setState(StateSearching, "network setup done")
+	}
+	if err := c.poll("AT+CEREG?", StateRegistered); err != nil {
+		return err
+	}
+	if err := c.poll("AT+CGATT?", StateAttached); err != nil {
+		return err
+	}
+	if err := RunSequence(c.port, c.setup.GetMsgResponse); err != nil {
+		return err
+	}
+	c.setState(StateReady, "message settings done")
+	return nil
+}
+
+// poll asks the module request until the state is reached, the URCs that
+// arrive in between are handled as well
+func (c *Connection) poll(request string, state ConnectionState) error {
+	for i := 0; i < c.Polls; i++ {
+		response, err := SendCommand(c.port, request, DefaultTimeout)
+		if err != nil {
+			return err
+		}
+		for _, line := range response {
+			switch {
+			case strings.HasPrefix(line, "+CEREG:") && request == "AT+CEREG?":
+				if reg, err := ParseCEREG(strings.TrimPrefix(line, "+CEREG:"), true); err == nil {
+					c.registration(reg.Stat)
+				}
+			case strings.HasPrefix(line, "+CGATT:"):
+				if strings.TrimSpace(strings.TrimPrefix(line, "+CGATT:")) == "1" && c.State() >= StateRegistered {
+					c.setState(StateAttached, "CGATT 1")
+				}
+			default:
+				c.HandleURC(line)
+			}
+		}
+		if c.State() >= state {
+			return nil
+		}
+		deadline := time.Now().Add(c.PollInterval)
+		for {
+			line, err := readLine(c.port, deadline)
+			if err != nil {
+				break
+			}
+			c.HandleURC(line)
+		}
+		if c.State() >= state {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s not reached after %d polls", state, c.Polls)
+}
+
+func (c *Connection) recover(r Recovery) error {
+	switch r {
+	case RecoverCOPS:
+		if err := selectOperator(c.port, c.setup); err != nil {
+			return err
+		}
+		c.setState(StateSearching, "COPS repeated")
+	case RecoverCFUN:
+		if _, err := SendCommand(c.port, "AT+CFUN=0", DefaultTimeout); err != nil {
+			return err
+		}
+		c.setState(StateRadioOff, "CFUN=0")
+	case RecoverReboot:
+		if _, err := RebootDevice(c.port, c.setup, RebootTimeout); err != nil {
+			return err
+		}
+		c.setState(StateRadioOff, "rebooted")
+	}
+	return nil
+}
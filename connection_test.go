@@ -0,0 +1,246 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// networkModule answers as a module that registers at the network after the
+// COPS request numbered registerAt, never when registerAt is 0. The requests
+// in silent go unanswered as often as given.
+type networkModule struct {
+	sim        simCard
+	registerAt int
+	silent     map[string]int
+	copses     int
+	registered bool
+}
+
+func (m *networkModule) answer(request string) []string {
+	if m.silent[request] > 0 {
+		m.silent[request]--
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(request, "AT+CPIN"):
+		return m.sim.answer(request)
+	case request == "AT+CFUN=0", request == "AT+NRB":
+		m.registered = false
+		if request == "AT+NRB" {
+			return []string{"REBOOTING", "OK"}
+		}
+	case strings.HasPrefix(request, "AT+COPS="):
+		m.copses++
+		m.registered = m.copses == m.registerAt || m.registered
+	case request == "AT+CEREG?":
+		if m.registered {
+			return []string{"+CEREG:1,1", "OK"}
+		}
+		return []string{"+CEREG:1,2", "OK"}
+	case request == "AT+CGATT?":
+		if m.registered {
+			return []string{"+CGATT:1", "OK"}
+		}
+		return []string{"+CGATT:0", "OK"}
+	}
+	return []string{"OK"}
+}
+
+var connectionSetup = Setup{
+	Setup:          "ublox02b",
+	SetupNetwork:   []RequestResponse{{Request: `AT+COPS=1,2,"20416"`, Response: "OK"}},
+	Reboot:         []RequestResponse{{Request: "AT+NRB", Response: "REBOOTING"}},
+	GetMsgResponse: []RequestResponse{{Request: "AT+NNMI=1", Response: "OK"}},
+}
+
+func testConnection(m *networkModule) (*Connection, *fakePort) {
+	port := newFakePort(m.answer)
+	c := NewConnection(port, connectionSetup)
+	c.Polls = 2
+	c.PollInterval = 10 * time.Millisecond
+	return c, port
+}
+
+// recoveries returns the recoveries noted in the history
+func recoveries(history []Transition) []string {
+	var r []string
+	for _, t := range history {
+		if strings.HasPrefix(t.Reason, "recovery: ") {
+			r = append(r, strings.TrimPrefix(t.Reason, "recovery: "))
+		}
+	}
+	return r
+}
+
+func TestConnect(t *testing.T) {
+	defer func(timeout time.Duration) { DefaultTimeout = timeout }(DefaultTimeout)
+	DefaultTimeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name       string
+		module     *networkModule
+		max        Recovery
+		ok         bool
+		recoveries []string
+	}{
+		{"at once", &networkModule{sim: simCard{state: "READY"}, registerAt: 1}, RecoverReboot, true, nil},
+		{"after COPS", &networkModule{sim: simCard{state: "READY"}, registerAt: 2}, RecoverReboot, true,
+			[]string{"repeat COPS"}},
+		{"after CFUN", &networkModule{sim: simCard{state: "READY"}, registerAt: 3}, RecoverReboot, true,
+			[]string{"repeat COPS", "CFUN cycle"}},
+		{"after reboot", &networkModule{sim: simCard{state: "READY"}, registerAt: 4}, RecoverReboot, true,
+			[]string{"repeat COPS", "CFUN cycle", "reboot"}},
+		{"gives up", &networkModule{sim: simCard{state: "READY"}}, RecoverCFUN, false,
+			[]string{"repeat COPS", "CFUN cycle"}},
+		{"SIM times out", &networkModule{sim: simCard{state: "READY"}, registerAt: 1,
+			silent: map[string]int{"AT+CPIN?": 1}}, RecoverReboot, true, []string{"repeat COPS"}},
+		{"unlocked", &networkModule{sim: simCard{state: "SIM PIN", pin: "1234"}, registerAt: 1}, RecoverReboot, true, nil},
+	}
+	for _, test := range tests {
+		c, _ := testConnection(test.module)
+		c.PIN = "1234"
+		c.MaxRecovery = test.max
+		err := c.Connect()
+		if (err == nil) != test.ok {
+			t.Errorf("%s: Connect = %v", test.name, err)
+		}
+		if _, ok := err.(*NonRecoverableError); ok {
+			t.Errorf("%s: Connect = %v, want a recoverable error", test.name, err)
+		}
+		history := c.History()
+		if got := recoveries(history); !reflect.DeepEqual(got, test.recoveries) {
+			t.Errorf("%s: recoveries %q, want %q", test.name, got, test.recoveries)
+		}
+		if !test.ok {
+			continue
+		}
+		if c.State() != StateReady {
+			t.Errorf("%s: state %s after Connect", test.name, c.State())
+		}
+		// the last bring up goes through all states
+		var states []ConnectionState
+		for _, tr := range history {
+			if tr.From != tr.To {
+				states = append(states, tr.To)
+			}
+		}
+		want := []ConnectionState{StateRegistered, StateAttached, StateReady}
+		if len(states) < len(want) || !reflect.DeepEqual(states[len(states)-len(want):], want) {
+			t.Errorf("%s: states %v, want them to end with %v", test.name, states, want)
+		}
+	}
+}
+
+func TestConnectSIMNotUsable(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		pin   string
+	}{
+		{"not inserted", "+CME ERROR: 10", "1234"},
+		{"PUK", "SIM PUK", "1234"},
+		{"no PIN", "SIM PIN", ""},
+		{"PIN rejected", "SIM PIN", "4321"},
+		{"PIN invalid", "SIM PIN", "12"},
+	}
+	for _, test := range tests {
+		m := &networkModule{sim: simCard{state: test.state, pin: "1234"}, registerAt: 1}
+		c, port := testConnection(m)
+		c.PIN = test.pin
+		err := c.Connect()
+		if _, ok := err.(*NonRecoverableError); !ok {
+			t.Errorf("%s: Connect = %v, want a NonRecoverableError", test.name, err)
+		}
+		if got := recoveries(c.History()); len(got) != 0 {
+			t.Errorf("%s: recovered with %q", test.name, got)
+		}
+		if m.copses != 0 {
+			t.Errorf("%s: network searched, requests %q", test.name, port.Requests())
+		}
+	}
+}
+
+func TestConnectionPoll(t *testing.T) {
+	m := &networkModule{}
+	c, port := testConnection(m)
+	c.Polls = 1
+	c.PollInterval = time.Second
+	c.setState(StateSearching, "test")
+	// the registration arrives as a URC after the answer
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		for _, b := range []byte("+CEREG: 5\r\n") {
+			port.out <- b
+		}
+	}()
+	if err := c.poll("AT+CEREG?", StateRegistered); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.poll("AT+CGATT?", StateAttached); err == nil {
+		t.Error("poll(AT+CGATT?) succeeded while the module answers 0")
+	}
+	if got := port.Requests(); !reflect.DeepEqual(got, []string{"AT+CEREG?", "AT+CGATT?"}) {
+		t.Errorf("requests %q", got)
+	}
+}
+
+func TestConnectionRecover(t *testing.T) {
+	tests := []struct {
+		r        Recovery
+		state    ConnectionState
+		requests []string
+	}{
+		{RecoverCOPS, StateSearching, []string{`AT+COPS=1,2,"20416"`}},
+		{RecoverCFUN, StateRadioOff, []string{"AT+CFUN=0"}},
+		{RecoverReboot, StateRadioOff, []string{"AT+NRB", "AT"}},
+	}
+	for _, test := range tests {
+		c, port := testConnection(&networkModule{})
+		c.setState(StateRegistered, "test")
+		if err := c.recover(test.r); err != nil {
+			t.Errorf("recover(%s) = %v", test.r, err)
+		}
+		if c.State() != test.state {
+			t.Errorf("recover(%s): state %s, want %s", test.r, c.State(), test.state)
+		}
+		if got := port.Requests(); !reflect.DeepEqual(got, test.requests) {
+			t.Errorf("recover(%s): requests %q, want %q", test.r, got, test.requests)
+		}
+	}
+}
+
+func TestHandleURC(t *testing.T) {
+	c, _ := testConnection(&networkModule{})
+	c.setState(StateSearching, "test")
+	tests := []struct {
+		line   string
+		ok     bool
+		state  ConnectionState
+		reason string
+	}{
+		{"+CEREG: 1", true, StateRegistered, "CEREG stat 1"},
+		{"+CEREG: 2", true, StateSearching, "CEREG stat 2"},
+		{`+CEREG: 5,"4E20","00A1B2C3",9`, true, StateRegistered, "CEREG stat 5"},
+		{"+CSCON: 1", true, StateRegistered, "RRC connected"},
+		{"+CSCON:0,0", true, StateRegistered, "RRC idle"},
+		{"+NNMI:1,00", false, StateRegistered, ""},
+	}
+	for _, test := range tests {
+		before := len(c.History())
+		if ok := c.HandleURC(test.line); ok != test.ok {
+			t.Errorf("HandleURC(%q) = %v", test.line, ok)
+		}
+		if c.State() != test.state {
+			t.Errorf("HandleURC(%q): state %s, want %s", test.line, c.State(), test.state)
+		}
+		history := c.History()
+		switch {
+		case len(test.reason) == 0 && len(history) != before:
+			t.Errorf("HandleURC(%q) added %v", test.line, history[before:])
+		case len(test.reason) != 0 && (len(history) != before+1 || history[before].Reason != test.reason):
+			t.Errorf("HandleURC(%q): history %v, want %s", test.line, history[before:], test.reason)
+		}
+	}
+}
@@ -1,11 +1,129 @@
 package senbiotpkg
 
 import (
+	"fmt"
 	"go.bug.st/serial.v1"
+	"strings"
+	"time"
 )
 
+// RebootTimeout is the longest a module may take to come up after a reboot,
+// a firmware update can make the first boot slow
+var RebootTimeout = 30 * time.Second
+
 func ConfigInfo(port serial.Port, c Setup) {
 	for _, v := range c.ConfigInfo {
 		ReadWritePort(port, v)
 	}
 }
+
+// DeviceMatch identifies the module a setup is meant for, every field that
+// is set has to be part of what the module reports
+type DeviceMatch struct {
+	Model    string `yaml:"model,omitempty"`
+	Firmware string `yaml:"firmware,omitempty"`
+}
+
+// Identity is the model and firmware reported by the module
+type Identity struct {
+	Model    string
+	Firmware string
+}
+
+// Matches reports whether the module identity fulfills the match rule
+func (m DeviceMatch) Matches(id Identity) bool {
+	if len(m.Model) == 0 && len(m.Firmware) == 0 {
+		return false
+	}
+	return strings.Contains(id.Model, m.Model) && strings.Contains(id.Firmware, m.Firmware)
+}
+
+// Identify asks the module for its model (AT+CGMM) and firmware (AT+CGMR)
+func Identify(port serial.Port) (Identity, error) {
+	var id Identity
+	model, err := SendCommand(port, "AT+CGMM", DefaultTimeout)
+	if err != nil {
+		return id, err
+	}
+	firmware, err := SendCommand(port, "AT+CGMR", DefaultTimeout)
+	if err != nil {
+		return id, err
+	}
+	id.Model = strings.Join(model, " ")
+	id.Firmware = strings.Join(firmware, " ")
+	return id, nil
+}
+
+// DetectDevice returns the device name of the first setup that matches the module
+func DetectDevice(c Setups, id Identity) (string, bool) {
+	for _, v := range c.Stps {
+		if v.Match.Matches(id) {
+			return v.Setup, true
+		}
+	}
+	return "", false
+}
+
+// ChooseDevice returns the device setup to use. The device given on the
+// commandline wins, else the device detected on the module, else the device
+// of the config file. A warning is shown when these disagree.
+func ChooseDevice(port serial.Port, c Setups, device string) string {
+	configured := device
+	if len(configured) == 0 {
+		configured = c.Device
+	}
+	id, err := Identify(port)
+	if err != nil {
+		fmt.Printf("could not identify module: %v\n", err)
+		return configured
+	}
+	detected, ok := DetectDevice(c, id)
+	if !ok {
+		fmt.Printf("no setup matches module %s %s\n", id.Model, id.Firmware)
+		return configured
+	}
+	if len(configured) != 0 && configured != detected {
+		fmt.Printf("warning: device %s is configured, but module %s %s matches %s\n", configured, id.Model, id.Firmware, detected)
+	}
+	if len(device) != 0 {
+		return device
+	}
+	fmt.Printf("device %s detected for module %s %s\n", detected, id.Model, id.Firmware)
+	return detected
+}
+
+// RebootDevice runs the reboot sequence of the setup and waits until the
+// module is ready again, at most timeout. It returns how long the boot took.
+func RebootDevice(port serial.Port, c Setup, timeout time.Duration) (time.Duration, error) {
+	if err := RunSequence(port, c.Reboot); err != nil {
+		return 0, err
+	}
+	return WaitForBoot(port, timeout)
+}
+
+// WaitForBoot waits for the OK that ends the boot banner of the module. When
+// the module stays quiet for a second it is asked with AT whether it is ready.
+// Lines that were read before the reboot are dropped, so an OK left over from
+// the reboot command does not end the wait.
+func WaitForBoot(port serial.Port, timeout time.Duration) (time.Duration, error) {
+	drainLines(port)
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for {
+		wait := time.Now().Add(time.Second)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		line, err := readLine(port, wait)
+		switch {
+		case err == ErrTimeout && time.Now().Before(deadline):
+			if _, err := port.Write([]byte("AT\r\n")); err != nil {
+				return time.Since(start), err
+			}
+		case err != nil:
+			return time.Since(start), err
+		case line == "OK":
+			return time.Since(start), nil
+		}
+	}
+}
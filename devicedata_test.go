@@ -0,0 +1,131 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testSetups = Setups{
+	Device: "ublox01b",
+	Stps: []Setup{
+		{Setup: "ublox01b", Match: DeviceMatch{Model: "SARA-N2", Firmware: "B656"}},
+		{Setup: "ublox02b", Match: DeviceMatch{Model: "SARA-N2", Firmware: "B657"}},
+		{Setup: "quicktel", Match: DeviceMatch{Model: "BC95"}},
+		{Setup: "quicktelbc66", Match: DeviceMatch{Model: "BC66"}},
+		{Setup: "nomatch"},
+	},
+}
+
+func TestDeviceMatch(t *testing.T) {
+	id := Identity{Model: "SARA-N211", Firmware: "+CGMR:V100R100C10B656"}
+	tests := []struct {
+		match DeviceMatch
+		want  bool
+	}{
+		{DeviceMatch{}, false},
+		{DeviceMatch{Model: "SARA-N2"}, true},
+		{DeviceMatch{Firmware: "B656"}, true},
+		{DeviceMatch{Model: "SARA-N2", Firmware: "B656"}, true},
+		{DeviceMatch{Model: "SARA-N2", Firmware: "B657"}, false},
+		{DeviceMatch{Model: "BC95"}, false},
+	}
+	for _, test := range tests {
+		if got := test.match.Matches(id); got != test.want {
+			t.Errorf("%+v.Matches(%+v) = %v, want %v", test.match, id, got, test.want)
+		}
+	}
+}
+
+// moduleAnswers answers AT+CGMM and AT+CGMR as a module would
+func moduleAnswers(model, firmware []string) func(string) []string {
+	return func(request string) []string {
+		switch request {
+		case "AT+CGMM":
+			return append(append([]string(nil), model...), "OK")
+		case "AT+CGMR":
+			return append(append([]string(nil), firmware...), "OK")
+		}
+		return []string{"ERROR"}
+	}
+}
+
+func TestIdentifyAndDetectDevice(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    []string
+		firmware []string
+		id       Identity
+		device   string
+		ok       bool
+	}{
+		{"SARA-N211 B656", []string{"SARA-N211"}, []string{"V100R100C10B656"},
+			Identity{"SARA-N211", "V100R100C10B656"}, "ublox01b", true},
+		{"SARA-N211 B657", []string{"SARA-N211"}, []string{"V100R100C10B657SP3"},
+			Identity{"SARA-N211", "V100R100C10B657SP3"}, "ublox02b", true},
+		{"BC95", []string{"Quectel", "BC95HB-02-STD_850"}, []string{"SECURITY,V100R100C10B657SP3", "PROTOCOL,V100R100C10B657SP3"},
+			Identity{"Quectel BC95HB-02-STD_850", "SECURITY,V100R100C10B657SP3 PROTOCOL,V100R100C10B657SP3"}, "quicktel", true},
+		{"BC66", []string{"BC66"}, []string{"Revision: BC66NBR01A07"},
+			Identity{"BC66", "Revision: BC66NBR01A07"}, "quicktelbc66", true},
+		{"unknown", []string{"SIM7000E"}, []string{"1351B04SIM7000E"},
+			Identity{"SIM7000E", "1351B04SIM7000E"}, "", false},
+	}
+	for _, test := range tests {
+		port := newFakePort(moduleAnswers(test.model, test.firmware))
+		id, err := Identify(port)
+		if err != nil || !reflect.DeepEqual(id, test.id) {
+			t.Errorf("%s: Identify = %+v, %v, want %+v", test.name, id, err, test.id)
+		}
+		device, ok := DetectDevice(testSetups, id)
+		if device != test.device || ok != test.ok {
+			t.Errorf("%s: DetectDevice = %q, %v, want %q", test.name, device, ok, test.device)
+		}
+	}
+}
+
+func TestChooseDevice(t *testing.T) {
+	bc66 := moduleAnswers([]string{"BC66"}, []string{"Revision: BC66NBR01A07"})
+	silent := func(string) []string { return []string{"ERROR"} }
+	tests := []struct {
+		name   string
+		answer func(string) []string
+		device string
+		want   string
+	}{
+		{"detected", bc66, "", "quicktelbc66"},
+		{"commandline wins", bc66, "quicktel", "quicktel"},
+		{"not identified", silent, "", "ublox01b"},
+		{"not identified, commandline", silent, "ublox02b", "ublox02b"},
+		{"no setup matches", moduleAnswers([]string{"SIM7000E"}, []string{"1351B04"}), "", "ublox01b"},
+	}
+	for _, test := range tests {
+		if got := ChooseDevice(newFakePort(test.answer), testSetups, test.device); got != test.want {
+			t.Errorf("%s: ChooseDevice = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWaitForBoot(t *testing.T) {
+	port := newFakePort(func(request string) []string {
+		if request == "AT" {
+			return []string{"OK"}
+		}
+		return nil
+	})
+	// an OK from before the reboot must not end the wait
+	port.Write([]byte("AT\r\n"))
+	waitQueued(t, port)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		for _, b := range []byte("REBOOTING\r\n\r\nu-blox\r\nOK\r\n") {
+			port.out <- b
+		}
+	}()
+	took, err := WaitForBoot(port, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took < 100*time.Millisecond {
+		t.Errorf("WaitForBoot returned after %v on the OK from before the reboot", took)
+	}
+}
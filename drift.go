@@ -0,0 +1,136 @@
+package senbiotpkg
+
+import (
+	"go.bug.st/serial.v1"
+	"strings"
+)
+
+// Setting is a module setting written by the init sequence, with the value
+// the sequence sets and the value the module has now
+type Setting struct {
+	Name    string
+	Want    string
+	Have    string
+	Request RequestResponse
+}
+
+// Differs reports whether the module does not have the value of the init sequence
+func (s Setting) Differs() bool {
+	return s.Want != s.Have
+}
+
+// normalize makes the values of a request and of a read comparable:
+// no quotes or spaces around parameters and upper case
+func normalize(params []string) []string {
+	for i, p := range params {
+		params[i] = strings.ToUpper(strings.Trim(strings.TrimSpace(p), "\""))
+	}
+	return params
+}
+
+// initSettings returns the NCONFIG, NCDP and CGDCONT settings of the init sequence
+func initSettings(c Setup) []Setting {
+	var settings []Setting
+	for _, v := range c.Init {
+		command, value := splitSetting(v.Request)
+		params := normalize(strings.Split(value, ","))
+		switch command {
+		case "AT+NCONFIG":
+			if len(params) == 2 {
+				settings = append(settings, Setting{Name: "NCONFIG " + params[0], Want: params[1], Request: v})
+			}
+		case "AT+NCDP":
+			settings = append(settings, Setting{Name: "NCDP", Want: ncdpValue(params), Request: v})
+		case "AT+CGDCONT":
+			if len(params) >= 3 {
+				settings = append(settings, Setting{Name: "CGDCONT " + params[0], Want: params[1] + "," + params[2], Request: v})
+			}
+		}
+	}
+	return settings
+}
+
+// ncdpValue is the server address, with the port only when it is not the default 5683
+func ncdpValue(params []string) string {
+	if len(params) > 1 && params[1] != "5683" && len(params[1]) != 0 {
+		return params[0] + ":" + params[1]
+	}
+	return params[0]
+}
+
+func splitSetting(request string) (string, string) {
+	i := strings.Index(request, "=")
+	if i < 0 {
+		return request, ""
+	}
+	return strings.TrimSpace(request[:i]), request[i+1:]
+}
+
+// moduleSettings reads the current NCONFIG, NCDP and CGDCONT settings
+func moduleSettings(port serial.Port) (map[string]string, error) {
+	have := make(map[string]string)
+	read := func(request, prefix string, add func(params []string)) error {
+		response, err := SendCommand(port, request, DefaultTimeout)
+		if err != nil {
+			return err
+		}
+		for _, line := range response {
+			if strings.HasPrefix(line, prefix) {
+				add(normalize(strings.Split(strings.TrimPrefix(line, prefix), ",")))
+			}
+		}
+		return nil
+	}
+	if err := read("AT+NCONFIG?", "+NCONFIG:", func(params []string) {
+		if len(params) == 2 {
+			have["NCONFIG "+params[0]] = params[1]
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if err := read("AT+NCDP?", "+NCDP:", func(params []string) {
+		have["NCDP"] = ncdpValue(params)
+	}); err != nil {
+		return nil, err
+	}
+	if err := read("AT+CGDCONT?", "+CGDCONT:", func(params []string) {
+		if len(params) >= 3 {
+			have["CGDCONT "+params[0]] = params[1] + "," + params[2]
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return have, nil
+}
+
+// ConfigDrift compares the settings the init sequence of the setup writes
+// with the settings the module has
+func ConfigDrift(port serial.Port, c Setup) ([]Setting, error) {
+	have, err := moduleSettings(port)
+	if err != nil {
+		return nil, err
+	}
+	settings := initSettings(c)
+	for i := range settings {
+		settings[i].Have = have[settings[i].Name]
+	}
+	return settings, nil
+}
+
+// ApplyDrift writes the settings that differ. The module only accepts them
+// with the radio off, so it is switched off first.
+func ApplyDrift(port serial.Port, settings []Setting) error {
+	var sequence []RequestResponse
+	for _, s := range settings {
+		if s.Differs() {
+			sequence = append(sequence, s.Request)
+		}
+	}
+	if len(sequence) == 0 {
+		return nil
+	}
+	if _, err := SendCommand(port, "AT+CFUN=0", DefaultTimeout); err != nil {
+		return err
+	}
+	return RunSequence(port, sequence)
+}
@@ -0,0 +1,100 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	got := normalize([]string{` "AUTOCONNECT"`, "true ", `"ip"`, ""})
+	if want := []string{"AUTOCONNECT", "TRUE", "IP", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("normalize = %q, want %q", got, want)
+	}
+}
+
+func TestNCDPValue(t *testing.T) {
+	tests := []struct {
+		params []string
+		want   string
+	}{
+		{[]string{"172.27.131.100"}, "172.27.131.100"},
+		{[]string{"172.27.131.100", "5683"}, "172.27.131.100"},
+		{[]string{"172.27.131.100", ""}, "172.27.131.100"},
+		{[]string{"172.27.131.100", "5684"}, "172.27.131.100:5684"},
+	}
+	for _, test := range tests {
+		if got := ncdpValue(test.params); got != test.want {
+			t.Errorf("ncdpValue(%q) = %s, want %s", test.params, got, test.want)
+		}
+	}
+}
+
+// driftSetup has the init requests of config.yml, quoted and not
+var driftSetup = Setup{Init: []RequestResponse{
+	{Request: "AT+NCONFIG=AUTOCONNECT,FALSE", Response: "OK"},
+	{Request: `AT+NCONFIG="CR_0354_0338_SCRAMBLING","TRUE"`, Response: "OK"},
+	{Request: "AT+NCDP=172.27.131.100", Response: "OK"},
+	{Request: `AT+CGDCONT=1,"IP","cdp.iot.t-mobile.nl"`, Response: "OK"},
+	{Request: "AT+NRB", Response: "REBOOTING"},
+}}
+
+func TestInitSettings(t *testing.T) {
+	want := []Setting{
+		{Name: "NCONFIG AUTOCONNECT", Want: "FALSE", Request: driftSetup.Init[0]},
+		{Name: "NCONFIG CR_0354_0338_SCRAMBLING", Want: "TRUE", Request: driftSetup.Init[1]},
+		{Name: "NCDP", Want: "172.27.131.100", Request: driftSetup.Init[2]},
+		{Name: "CGDCONT 1", Want: "IP,CDP.IOT.T-MOBILE.NL", Request: driftSetup.Init[3]},
+	}
+	if got := initSettings(driftSetup); !reflect.DeepEqual(got, want) {
+		t.Errorf("initSettings = %+v, want %+v", got, want)
+	}
+}
+
+// driftModule answers the reads of the settings like a module, with the
+// server on the default port given explicitly
+func driftModule(request string) []string {
+	switch request {
+	case "AT+NCONFIG?":
+		return []string{
+			`+NCONFIG:"AUTOCONNECT","TRUE"`,
+			`+NCONFIG:"CR_0354_0338_SCRAMBLING","TRUE"`,
+			"OK",
+		}
+	case "AT+NCDP?":
+		return []string{"+NCDP:172.27.131.100,5683", "OK"}
+	case "AT+CGDCONT?":
+		return []string{`+CGDCONT:1,"IP","cdp.iot.t-mobile.nl",,0,0,,,,,0`, "OK"}
+	}
+	return []string{"OK"}
+}
+
+func TestConfigDrift(t *testing.T) {
+	port := newFakePort(driftModule)
+	settings, err := ConfigDrift(port, driftSetup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var differs []string
+	for _, s := range settings {
+		if s.Differs() {
+			differs = append(differs, s.Name+" "+s.Have+" "+s.Want)
+		}
+	}
+	if want := []string{"NCONFIG AUTOCONNECT TRUE FALSE"}; !reflect.DeepEqual(differs, want) {
+		t.Errorf("differing settings %q, want %q", differs, want)
+	}
+
+	if err := ApplyDrift(port, settings); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"AT+NCONFIG?", "AT+NCDP?", "AT+CGDCONT?", "AT+CFUN=0", "AT+NCONFIG=AUTOCONNECT,FALSE"}
+	if got := port.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests %q, want %q", got, want)
+	}
+
+	// nothing is written when nothing differs
+	port = newFakePort(driftModule)
+	if err := ApplyDrift(port, settings[1:]); err != nil || len(port.Requests()) != 0 {
+		t.Errorf("ApplyDrift without differences = %v, requests %q", err, port.Requests())
+	}
+}
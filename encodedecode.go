@@ -1,60 +1,213 @@
 package senbiotpkg
 
 import (
+	"encoding/base32"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
+	"sync"
 )
 
+// hexMessageCodec is the codec of the hex message helpers below
+func hexMessageCodec() Codec {
+	c, _ := CodecByName("hex")
+	return c
+}
+
 func EncodeMessageByte(messagebyte []byte) string {
-	//fmt.Println(messagebyte)
-	dst := make([]byte, hex.EncodedLen(len(messagebyte)))
-	hex.Encode(dst, messagebyte)
-	sendString := fmt.Sprintf("%s", dst)
-	//fmt.Println(sendString)
-	return sendString
+	dst, _ := hexMessageCodec().Encode(messagebyte)
+	return string(dst)
 }
 
 func EncodeMessageString(messageString string) string {
-	//fmt.Println(messageString)
-	messagebyte := []byte(messageString)
-	dst := make([]byte, hex.EncodedLen(len(messagebyte)))
-	hex.Encode(dst, messagebyte)
-	sendString := fmt.Sprintf("%s", dst)
-	//fmt.Println(sendString)
-	return sendString
-}
-
-func DecodeMessageByte(messagebyte []byte) string {
-	decoded := make([]byte, hex.DecodedLen(len(messagebyte)))
-	n, err := hex.Decode(decoded, messagebyte)
+	return EncodeMessageByte([]byte(messageString))
+}
+
+// DecodeMessageByte returns the text of a hex encoded message
+func DecodeMessageByte(messagebyte []byte) (string, error) {
+	decoded, err := hexMessageCodec().Decode(messagebyte)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	receiveString := fmt.Sprintf("%s", decoded[:n])
-	return receiveString
+	return string(decoded), nil
 }
 
-func DecodeMessageString(message string) string {
-	decoded, _ := hex.DecodeString(message)
-	receiveString := fmt.Sprintf("%s", decoded)
-	return receiveString
+// DecodeMessageString returns the text of a hex encoded message
+func DecodeMessageString(message string) (string, error) {
+	return DecodeMessageByte([]byte(message))
 }
 
-func DecodeBase64MessageByte(messagebyte []byte) string {
+// DecodeBase64MessageByte returns the text of a base64 encoded message
+func DecodeBase64MessageByte(messagebyte []byte) (string, error) {
 	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(messagebyte)))
-	_, err := base64.StdEncoding.Decode(decoded, messagebyte)
+	n, err := base64.StdEncoding.Decode(decoded, messagebyte)
 	if err != nil {
-		return fmt.Sprintf("error:", err)
+		return "", err
 	}
-	return fmt.Sprintf("%s", decoded)
+	return string(decoded[:n]), nil
 }
 
-func DecodeBase64MessageString(messagestring string) string {
-	decoded, err := base64.StdEncoding.DecodeString(messagestring)
-	if err != nil {
-		return fmt.Sprintf("error:", err)
+// DecodeBase64MessageString returns the text of a base64 encoded message
+func DecodeBase64MessageString(messagestring string) (string, error) {
+	return DecodeBase64MessageByte([]byte(messagestring))
+}
+
+// Codec encodes message payloads to text and back
+type Codec interface {
+	Name() string
+	Encode(src []byte) ([]byte, error)
+	Decode(src []byte) ([]byte, error)
+}
+
+var (
+	codecsMu sync.Mutex
+	codecs   = make(map[string]Codec)
+	// detectOrder is the order in which DetectCodec tries the codecs, hex
+	// first as that is what NB-IoT modules use
+	detectOrder []string
+)
+
+// RegisterCodec makes a codec available by its name
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecs[c.Name()]; !ok {
+		detectOrder = append(detectOrder, c.Name())
+	}
+	codecs[c.Name()] = c
+}
+
+// CodecByName returns the registered codec with the given name
+func CodecByName(name string) (Codec, error) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %s", name)
+	}
+	return c, nil
+}
+
+// CodecNames returns the names of the registered codecs
+func CodecNames() []string {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	return append([]string(nil), detectOrder...)
+}
+
+// DetectCodec returns the first registered codec that can decode src
+func DetectCodec(src []byte) (Codec, error) {
+	for _, name := range CodecNames() {
+		c, _ := CodecByName(name)
+		if _, err := c.Decode(src); err == nil {
+			return c, nil
+		}
+	}
+	return nil, errors.New("encoding of message not recognized")
+}
+
+func init() {
+	RegisterCodec(hexCodec{})
+	RegisterCodec(base32Codec{})
+	RegisterCodec(base64Codec{"base64", base64.StdEncoding})
+	RegisterCodec(base64Codec{"base64url", base64.URLEncoding})
+	RegisterCodec(z85Codec{})
+}
+
+type hexCodec struct{}
+
+func (hexCodec) Name() string { return "hex" }
+
+func (hexCodec) Encode(src []byte) ([]byte, error) {
+	dst := make([]byte, hex.EncodedLen(len(src)))
+	hex.Encode(dst, src)
+	return dst, nil
+}
+
+func (hexCodec) Decode(src []byte) ([]byte, error) {
+	return ParseHex(src)
+}
+
+type base64Codec struct {
+	name string
+	enc  *base64.Encoding
+}
+
+func (c base64Codec) Name() string { return c.name }
+
+func (c base64Codec) Encode(src []byte) ([]byte, error) {
+	dst := make([]byte, c.enc.EncodedLen(len(src)))
+	c.enc.Encode(dst, src)
+	return dst, nil
+}
+
+func (c base64Codec) Decode(src []byte) ([]byte, error) {
+	dst := make([]byte, c.enc.DecodedLen(len(src)))
+	n, err := c.enc.Decode(dst, src)
+	return dst[:n], err
+}
+
+type base32Codec struct{}
+
+func (base32Codec) Name() string { return "base32" }
+
+func (base32Codec) Encode(src []byte) ([]byte, error) {
+	dst := make([]byte, base32.StdEncoding.EncodedLen(len(src)))
+	base32.StdEncoding.Encode(dst, src)
+	return dst, nil
+}
+
+func (base32Codec) Decode(src []byte) ([]byte, error) {
+	dst := make([]byte, base32.StdEncoding.DecodedLen(len(src)))
+	n, err := base32.StdEncoding.Decode(dst, src)
+	return dst[:n], err
+}
+
+// z85Codec is the ZeroMQ Base-85 encoding, which needs a multiple of 4 bytes
+type z85Codec struct{}
+
+const z85Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+func (z85Codec) Name() string { return "z85" }
+
+func (z85Codec) Encode(src []byte) ([]byte, error) {
+	if len(src)%4 != 0 {
+		return nil, fmt.Errorf("z85 needs a multiple of 4 bytes, got %d", len(src))
+	}
+	dst := make([]byte, 0, len(src)/4*5)
+	for i := 0; i < len(src); i += 4 {
+		value := binary.BigEndian.Uint32(src[i:])
+		var chunk [5]byte
+		for j := 4; j >= 0; j-- {
+			chunk[j] = z85Alphabet[value%85]
+			value /= 85
+		}
+		dst = append(dst, chunk[:]...)
+	}
+	return dst, nil
+}
+
+func (z85Codec) Decode(src []byte) ([]byte, error) {
+	if len(src)%5 != 0 {
+		return nil, fmt.Errorf("z85 needs a multiple of 5 characters, got %d", len(src))
+	}
+	dst := make([]byte, 0, len(src)/5*4)
+	for i := 0; i < len(src); i += 5 {
+		var value uint64
+		for j := 0; j < 5; j++ {
+			digit := strings.IndexByte(z85Alphabet, src[i+j])
+			if digit < 0 {
+				return nil, fmt.Errorf("invalid z85 character %q at position %d", src[i+j], i+j)
+			}
+			value = value*85 + uint64(digit)
+		}
+		if value > 0xffffffff {
+			return nil, fmt.Errorf("invalid z85 group at position %d", i)
+		}
+		dst = append(dst, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
 	}
-	return fmt.Sprintf("%s", decoded)
+	return dst, nil
 }
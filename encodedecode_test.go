@@ -0,0 +1,119 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	tests := []struct {
+		codec   string
+		decoded []byte
+		encoded string
+	}{
+		{"hex", []byte("Hello"), "48656c6c6f"},
+		{"hex", nil, ""},
+		{"base32", []byte("Hello"), "JBSWY3DP"},
+		{"base64", []byte("Hello"), "SGVsbG8="},
+		{"base64", []byte{0xfb, 0xff}, "+/8="},
+		{"base64url", []byte{0xfb, 0xff}, "-_8="},
+		{"z85", []byte{0x86, 0x4f, 0xd2, 0x6f, 0xb5, 0x59, 0xf7, 0x5b}, "HelloWorld"},
+	}
+	for _, test := range tests {
+		c, err := CodecByName(test.codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := c.Encode(test.decoded)
+		if err != nil || string(encoded) != test.encoded {
+			t.Errorf("%s Encode(%x) = %q, %v, want %q", test.codec, test.decoded, encoded, err, test.encoded)
+		}
+		decoded, err := c.Decode([]byte(test.encoded))
+		if err != nil || !bytes.Equal(decoded, test.decoded) {
+			t.Errorf("%s Decode(%q) = %x, %v, want %x", test.codec, test.encoded, decoded, err, test.decoded)
+		}
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	tests := []struct {
+		codec, encoded string
+	}{
+		{"hex", "48656c6c6"},
+		{"hex", "4865zz"},
+		{"base32", "JBSWY3D"},
+		{"base64", "SGVsbG8"},
+		{"base64url", "+/8="},
+		{"z85", "Hello"[:4]},
+		{"z85", "Hello~orld"},
+		{"z85", "#####"},
+	}
+	for _, test := range tests {
+		c, _ := CodecByName(test.codec)
+		if decoded, err := c.Decode([]byte(test.encoded)); err == nil {
+			t.Errorf("%s Decode(%q) = %x, want an error", test.codec, test.encoded, decoded)
+		}
+	}
+	z85, _ := CodecByName("z85")
+	if _, err := z85.Encode([]byte{1, 2, 3}); err == nil {
+		t.Error("z85 encoded 3 bytes")
+	}
+	if _, err := CodecByName("rot13"); err == nil {
+		t.Error("unknown codec found")
+	}
+}
+
+func TestDetectCodec(t *testing.T) {
+	tests := []struct {
+		encoded, want string
+	}{
+		{"48656c6c6f", "hex"},
+		{"+NNMI:5,48656C6C6F", "hex"},
+		{"JBSWY3DP", "base32"},
+		{"SGVsbG8=", "base64"},
+		{"-_8=", "base64url"},
+		{"HelloWorld", "z85"},
+	}
+	for _, test := range tests {
+		c, err := DetectCodec([]byte(test.encoded))
+		if err != nil {
+			t.Errorf("DetectCodec(%q): %v", test.encoded, err)
+		} else if c.Name() != test.want {
+			t.Errorf("DetectCodec(%q) = %s, want %s", test.encoded, c.Name(), test.want)
+		}
+	}
+	if c, err := DetectCodec([]byte("~~~")); err == nil {
+		t.Errorf("DetectCodec(~~~) = %s, want an error", c.Name())
+	}
+}
+
+func TestHexMessageHelpers(t *testing.T) {
+	if got := EncodeMessageString("Hello"); got != "48656c6c6f" {
+		t.Errorf("EncodeMessageString = %q", got)
+	}
+	if got := EncodeMessageByte([]byte{0, 0xff}); got != "00ff" {
+		t.Errorf("EncodeMessageByte = %q", got)
+	}
+	decoders := []struct {
+		name   string
+		decode func(string) (string, error)
+		in     string
+		want   string
+		err    bool
+	}{
+		{"DecodeMessageByte", func(s string) (string, error) { return DecodeMessageByte([]byte(s)) }, "48 65 6c 6c 6f", "Hello", false},
+		{"DecodeMessageByte", func(s string) (string, error) { return DecodeMessageByte([]byte(s)) }, "4865zz", "", true},
+		{"DecodeMessageString", DecodeMessageString, "48656C6C6F", "Hello", false},
+		{"DecodeMessageString", DecodeMessageString, "4865zz", "", true},
+		{"DecodeBase64MessageByte", func(s string) (string, error) { return DecodeBase64MessageByte([]byte(s)) }, "SGVsbG8=", "Hello", false},
+		{"DecodeBase64MessageByte", func(s string) (string, error) { return DecodeBase64MessageByte([]byte(s)) }, "SGVsbG8", "", true},
+		{"DecodeBase64MessageString", DecodeBase64MessageString, "SGVsbG8=", "Hello", false},
+		{"DecodeBase64MessageString", DecodeBase64MessageString, "SGV$bG8=", "", true},
+	}
+	for _, test := range decoders {
+		got, err := test.decode(test.in)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("%s(%q) = %q, %v, want %q", test.name, test.in, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package senbiotpkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An envelope puts a sequence number, and optionally a timestamp and payload
+// type, in front of the payload:
+//
+//	0xb0 | version, flags, sequence (4 bytes), [unix time (4 bytes)], [type], payload
+//
+// All numbers are big endian.
+const (
+	EnvelopeMarker  = 0xb0
+	EnvelopeVersion = 1
+
+	envelopeTime = 1 << 0
+	envelopeType = 1 << 1
+)
+
+// Envelope is a payload with its sequence number and optional timestamp and type
+type Envelope struct {
+	Version  uint8
+	Sequence uint32
+	// Time is the zero time without timestamp
+	Time    time.Time
+	Type    uint8
+	HasType bool
+	Payload []byte
+}
+
+// NewEnvelope puts the payload in an envelope with the next sequence number of counter
+func NewEnvelope(counter *Counter, payload []byte) (Envelope, error) {
+	n, err := counter.Next()
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Version: EnvelopeVersion, Sequence: n, Payload: payload}, nil
+}
+
+// SequenceFile returns the file with the sequence number of a device next
+// to the config file, eg config-ublox01b.sequence for config.yml
+func SequenceFile(config, device string) string {
+	base := config[:len(config)-len(filepath.Ext(config))]
+	return base + "-" + device + ".sequence"
+}
+
+// Bytes returns the envelope and payload as sent
+func (e Envelope) Bytes() []byte {
+	b := []byte{EnvelopeMarker | EnvelopeVersion, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[2:], e.Sequence)
+	if !e.Time.IsZero() {
+		b[1] |= envelopeTime
+		b = append(b, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], uint32(e.Time.Unix()))
+	}
+	if e.HasType {
+		b[1] |= envelopeType
+		b = append(b, e.Type)
+	}
+	return append(b, e.Payload...)
+}
+
+// IsEnvelope reports whether the payload starts with an envelope header
+func IsEnvelope(payload []byte) bool {
+	return len(payload) >= 6 && payload[0]&0xf0 == EnvelopeMarker && payload[1]&^(envelopeTime|envelopeType) == 0
+}
+
+// ParseEnvelope splits a received payload in its envelope and payload
+func ParseEnvelope(payload []byte) (Envelope, error) {
+	if !IsEnvelope(payload) {
+		return Envelope{}, errors.New("payload has no envelope")
+	}
+	e := Envelope{Version: payload[0] & 0x0f}
+	if e.Version != EnvelopeVersion {
+		return e, fmt.Errorf("envelope version %d is not supported", e.Version)
+	}
+	flags := payload[1]
+	e.Sequence = binary.BigEndian.Uint32(payload[2:])
+	rest := payload[6:]
+	if flags&envelopeTime != 0 {
+		if len(rest) < 4 {
+			return e, errors.New("envelope ends in the timestamp")
+		}
+		e.Time = time.Unix(int64(binary.BigEndian.Uint32(rest)), 0).UTC()
+		rest = rest[4:]
+	}
+	if flags&envelopeType != 0 {
+		if len(rest) < 1 {
+			return e, errors.New("envelope ends in the payload type")
+		}
+		e.Type, e.HasType = rest[0], true
+		rest = rest[1:]
+	}
+	e.Payload = rest
+	return e, nil
+}
+
+func (e Envelope) String() string {
+	s := fmt.Sprintf("sequence %d", e.Sequence)
+	if !e.Time.IsZero() {
+		s += ", time " + e.Time.Format(time.RFC3339)
+	}
+	if e.HasType {
+		s += fmt.Sprintf(", type %d", e.Type)
+	}
+	return s
+}
+
+// SequenceReport tells how a received sequence number fits the ones before
+type SequenceReport struct {
+	Device   string
+	Sequence uint32
+	// Missing are the sequence numbers skipped by this one
+	Missing []uint32
+	// Late is set for a sequence number that was missing before
+	Late bool
+	// Duplicate is set for a sequence number that was received before
+	Duplicate bool
+	// Restart is set when the sequence starts again at 1, eg after the
+	// counter file of the device was lost
+	Restart bool
+}
+
+func (r SequenceReport) String() string {
+	switch {
+	case r.Duplicate:
+		return fmt.Sprintf("%s: duplicate %d", r.Device, r.Sequence)
+	case r.Restart:
+		return fmt.Sprintf("%s: restarted at %d", r.Device, r.Sequence)
+	case r.Late:
+		return fmt.Sprintf("%s: %d arrived late", r.Device, r.Sequence)
+	case len(r.Missing) == 1:
+		return fmt.Sprintf("%s: %d is missing", r.Device, r.Missing[0])
+	case len(r.Missing) > 1:
+		return fmt.Sprintf("%s: %d to %d are missing", r.Device, r.Missing[0], r.Missing[len(r.Missing)-1])
+	}
+	return fmt.Sprintf("%s: %d", r.Device, r.Sequence)
+}
+
+// MaxGap is the largest number of missing sequence numbers a report lists
+var MaxGap = 1000
+
+// SequenceTracker follows the sequence numbers of each device on the backend
+type SequenceTracker struct {
+	mu      sync.Mutex
+	highest map[string]uint32
+	missing map[string]map[uint32]bool
+}
+
+// NewSequenceTracker returns a tracker that has not seen any device
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{highest: make(map[string]uint32), missing: make(map[string]map[uint32]bool)}
+}
+
+// Observe records sequence number n of the device and reports the gap it
+// leaves or whether it is late or a duplicate
+func (t *SequenceTracker) Observe(device string, n uint32) SequenceReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := SequenceReport{Device: device, Sequence: n}
+	highest, ok := t.highest[device]
+	if t.missing[device] == nil {
+		t.missing[device] = make(map[uint32]bool)
+	}
+	switch {
+	case !ok:
+		t.highest[device] = n
+	case n > highest:
+		for m := highest + 1; m < n; m++ {
+			if len(r.Missing) == MaxGap {
+				break
+			}
+			r.Missing = append(r.Missing, m)
+			t.missing[device][m] = true
+		}
+		t.highest[device] = n
+	case n == 1 && highest > 1:
+		r.Restart = true
+		t.highest[device] = n
+		t.missing[device] = make(map[uint32]bool)
+	case t.missing[device][n]:
+		r.Late = true
+		delete(t.missing[device], n)
+	default:
+		r.Duplicate = true
+	}
+	return r
+}
+
+// Missing returns the sequence numbers of the device that did not arrive yet
+func (t *SequenceTracker) Missing(device string) []uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var missing []uint32
+	for n := range t.missing[device] {
+		missing = append(missing, n)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return missing
+}
@@ -0,0 +1,116 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	tests := []Envelope{
+		{Version: EnvelopeVersion, Sequence: 1, Payload: []byte("payload")},
+		{Version: EnvelopeVersion, Sequence: 0xdeadbeef, Time: time.Unix(1700000000, 0).UTC(), Payload: []byte{}},
+		{Version: EnvelopeVersion, Sequence: 7, Type: 3, HasType: true, Payload: []byte{0x01, 0x67}},
+		{Version: EnvelopeVersion, Sequence: 8, Time: time.Unix(1, 0).UTC(), Type: 0, HasType: true, Payload: []byte("x")},
+	}
+	for _, e := range tests {
+		got, err := ParseEnvelope(e.Bytes())
+		if err != nil {
+			t.Errorf("ParseEnvelope(%x): %v", e.Bytes(), err)
+			continue
+		}
+		if got.Sequence != e.Sequence || !got.Time.Equal(e.Time) || got.HasType != e.HasType || got.Type != e.Type || !bytes.Equal(got.Payload, e.Payload) {
+			t.Errorf("ParseEnvelope(%x) = %v, want %v", e.Bytes(), got, e)
+		}
+	}
+}
+
+func TestParseEnvelopeErrors(t *testing.T) {
+	tests := [][]byte{
+		{},
+		{0xb1, 0, 0, 0, 1},
+		{0xc1, 0, 0, 0, 0, 1},
+		{0xb2, 0, 0, 0, 0, 1},
+		{0xb1, 0x04, 0, 0, 0, 1},
+		{0xb1, envelopeTime, 0, 0, 0, 1, 0, 0},
+		{0xb1, envelopeType, 0, 0, 0, 1},
+	}
+	for _, payload := range tests {
+		if e, err := ParseEnvelope(payload); err == nil {
+			t.Errorf("ParseEnvelope(%x) = %v, want an error", payload, e)
+		}
+	}
+}
+
+func TestSequenceTrackerObserve(t *testing.T) {
+	MaxGap = 5
+	defer func() { MaxGap = 1000 }()
+	tests := []struct {
+		n    uint32
+		want SequenceReport
+	}{
+		{1, SequenceReport{Sequence: 1}},
+		{2, SequenceReport{Sequence: 2}},
+		{5, SequenceReport{Sequence: 5, Missing: []uint32{3, 4}}},
+		{4, SequenceReport{Sequence: 4, Late: true}},
+		{4, SequenceReport{Sequence: 4, Duplicate: true}},
+		{2, SequenceReport{Sequence: 2, Duplicate: true}},
+		{6, SequenceReport{Sequence: 6}},
+		{20, SequenceReport{Sequence: 20, Missing: []uint32{7, 8, 9, 10, 11}}},
+		{1, SequenceReport{Sequence: 1, Restart: true}},
+		{3, SequenceReport{Sequence: 3, Missing: []uint32{2}}},
+	}
+	tracker := NewSequenceTracker()
+	for _, test := range tests {
+		test.want.Device = "sensor"
+		if got := tracker.Observe("sensor", test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Observe(%d) = %+v, want %+v", test.n, got, test.want)
+		}
+	}
+	if got := tracker.Missing("sensor"); !reflect.DeepEqual(got, []uint32{2}) {
+		t.Errorf("Missing = %v, want [2]", got)
+	}
+	// devices are followed apart
+	if r := tracker.Observe("other", 10); len(r.Missing) != 0 || r.Duplicate {
+		t.Errorf("Observe of another device = %v", r)
+	}
+	if got := tracker.Missing("other"); len(got) != 0 {
+		t.Errorf("Missing of another device = %v", got)
+	}
+}
+
+func TestSequenceReportString(t *testing.T) {
+	tests := []struct {
+		report SequenceReport
+		want   string
+	}{
+		{SequenceReport{Device: "d", Sequence: 3}, "d: 3"},
+		{SequenceReport{Device: "d", Sequence: 3, Missing: []uint32{2}}, "d: 2 is missing"},
+		{SequenceReport{Device: "d", Sequence: 9, Missing: []uint32{4, 5, 6, 7, 8}}, "d: 4 to 8 are missing"},
+		{SequenceReport{Device: "d", Sequence: 4, Late: true}, "d: 4 arrived late"},
+		{SequenceReport{Device: "d", Sequence: 4, Duplicate: true}, "d: duplicate 4"},
+		{SequenceReport{Device: "d", Sequence: 1, Restart: true}, "d: restarted at 1"},
+	}
+	for _, test := range tests {
+		if got := test.report.String(); got != test.want {
+			t.Errorf("String() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestSequenceFile(t *testing.T) {
+	tests := []struct {
+		config, device, want string
+	}{
+		{"config.yml", "ublox01b", "config-ublox01b.sequence"},
+		{filepath.Join("etc", "senbiot", "config.yml"), "quicktel", filepath.Join("etc", "senbiot", "config-quicktel.sequence")},
+		{"setup", "bc66", "setup-bc66.sequence"},
+	}
+	for _, test := range tests {
+		if got := SequenceFile(test.config, test.device); got != test.want {
+			t.Errorf("SequenceFile(%q, %q) = %q, want %q", test.config, test.device, got, test.want)
+		}
+	}
+}
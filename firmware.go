@@ -0,0 +1,101 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strings"
+	"time"
+)
+
+// FirmwareChunkSize is the number of bytes sent with each AT+NFWUPD=1
+var FirmwareChunkSize = 256
+
+// FirmwareRetries is how often a chunk is sent again after the module rejected it
+var FirmwareRetries = 3
+
+// UpgradeTimeout is how long the module may take to install the firmware and reboot
+var UpgradeTimeout = 10 * time.Minute
+
+// FirmwareVersion returns the firmware version the module reports with ATi9
+func FirmwareVersion(port serial.Port) (string, error) {
+	response, err := SendCommand(port, "ATi9", DefaultTimeout)
+	if err != nil {
+		return "", err
+	}
+	if len(response) == 0 {
+		return "", errors.New("no firmware version in response")
+	}
+	return strings.Join(response, " "), nil
+}
+
+// firmwareChecksum is the XOR of the bytes of a chunk
+func firmwareChecksum(chunk []byte) byte {
+	var crc byte
+	for _, b := range chunk {
+		crc ^= b
+	}
+	return crc
+}
+
+// DownloadFirmware transfers a delta firmware package to the module in
+// chunks and has the module validate it. A chunk that fails is sent again
+// up to FirmwareRetries times. progress, when not nil, is called after each
+// chunk with the bytes sent so far.
+func DownloadFirmware(port serial.Port, firmware []byte, progress func(sent, total int)) error {
+	if len(firmware) == 0 {
+		return errors.New("empty firmware package")
+	}
+	// clear a previous package
+	if _, err := SendCommand(port, "AT+NFWUPD=0", DefaultTimeout); err != nil {
+		return err
+	}
+	for sn, sent := 0, 0; sent < len(firmware); sn++ {
+		end := sent + FirmwareChunkSize
+		if end > len(firmware) {
+			end = len(firmware)
+		}
+		chunk := firmware[sent:end]
+		request := fmt.Sprintf("AT+NFWUPD=1,%d,%d,%s,%d", sn, len(chunk), EncodeMessageByte(chunk), firmwareChecksum(chunk))
+		for try := 0; ; try++ {
+			_, err := SendCommand(port, request, DefaultTimeout)
+			if err == nil {
+				break
+			}
+			if try == FirmwareRetries {
+				return fmt.Errorf("chunk %d: %v", sn, err)
+			}
+		}
+		sent = end
+		if progress != nil {
+			progress(sent, len(firmware))
+		}
+	}
+	if _, err := SendCommand(port, "AT+NFWUPD=2", DefaultTimeout); err != nil {
+		return fmt.Errorf("firmware package not valid: %v", err)
+	}
+	return nil
+}
+
+// UpdateFirmware downloads the firmware package, starts the upgrade, waits
+// until the module has rebooted and returns the new firmware version. before
+// is the version of the module as read with FirmwareVersion.
+func UpdateFirmware(port serial.Port, firmware []byte, before string, progress func(sent, total int)) (string, error) {
+	if err := DownloadFirmware(port, firmware, progress); err != nil {
+		return "", err
+	}
+	if _, err := SendCommand(port, "AT+NFWUPD=5", DefaultTimeout); err != nil {
+		return "", fmt.Errorf("could not start upgrade: %v", err)
+	}
+	if _, err := WaitForBoot(port, UpgradeTimeout); err != nil {
+		return "", fmt.Errorf("module did not come up after upgrade: %v", err)
+	}
+	after, err := FirmwareVersion(port)
+	if err != nil {
+		return "", err
+	}
+	if after == before {
+		return after, fmt.Errorf("firmware still at version %s", after)
+	}
+	return after, nil
+}
@@ -0,0 +1,212 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePort is a serial port that answers every request with the lines
+// returned by answer, the final result code included
+type fakePort struct {
+	serial.Port
+	answer func(request string) []string
+
+	mu       sync.Mutex
+	requests []string
+	out      chan byte
+}
+
+func newFakePort(answer func(request string) []string) *fakePort {
+	return &fakePort{answer: answer, out: make(chan byte, 1<<16)}
+}
+
+func (f *fakePort) Write(p []byte) (int, error) {
+	request := strings.TrimSpace(string(p))
+	f.mu.Lock()
+	f.requests = append(f.requests, request)
+	f.mu.Unlock()
+	for _, line := range f.answer(request) {
+		for _, b := range []byte(line + "\r\n") {
+			f.out <- b
+		}
+	}
+	return len(p), nil
+}
+
+func (f *fakePort) Read(p []byte) (int, error) {
+	b, ok := <-f.out
+	if !ok {
+		return 0, io.EOF
+	}
+	p[0] = b
+	return 1, nil
+}
+
+func (f *fakePort) Close() error {
+	close(f.out)
+	return nil
+}
+
+func (f *fakePort) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func TestFirmwareChecksum(t *testing.T) {
+	tests := []struct {
+		chunk []byte
+		want  byte
+	}{
+		{nil, 0},
+		{[]byte{0x5a}, 0x5a},
+		{[]byte{0x01, 0x02, 0x04}, 0x07},
+		{[]byte{0xff, 0xff}, 0},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, 0x08},
+	}
+	for _, test := range tests {
+		if got := firmwareChecksum(test.chunk); got != test.want {
+			t.Errorf("firmwareChecksum(%x) = %#x, want %#x", test.chunk, got, test.want)
+		}
+	}
+}
+
+// firmwareModule answers the NFWUPD commands like a module, it checks the
+// chunks and rejects the chunks in fail the first time they are sent
+type firmwareModule struct {
+	version  string
+	received bytes.Buffer
+	fail     map[int]bool
+	err      error
+}
+
+func (m *firmwareModule) answer(request string) []string {
+	switch {
+	case request == "AT":
+		return []string{"OK"}
+	case request == "ATi9":
+		return []string{m.version, "OK"}
+	case request == "AT+NFWUPD=0":
+		m.received.Reset()
+		return []string{"OK"}
+	case strings.HasPrefix(request, "AT+NFWUPD=1,"):
+		var sn, length, crc int
+		var data string
+		if _, err := fmt.Sscanf(strings.Replace(strings.TrimPrefix(request, "AT+NFWUPD=1,"), ",", " ", -1), "%d %d %s %d", &sn, &length, &data, &crc); err != nil {
+			m.err = fmt.Errorf("%s: %v", request, err)
+			return []string{"ERROR"}
+		}
+		chunk, err := hex.DecodeString(data)
+		if err != nil || len(chunk) != length || int(firmwareChecksum(chunk)) != crc {
+			m.err = fmt.Errorf("invalid chunk %s", request)
+			return []string{"ERROR"}
+		}
+		if m.fail[sn] {
+			m.fail[sn] = false
+			return []string{"+CME ERROR: 4"}
+		}
+		m.received.Write(chunk)
+		return []string{"OK"}
+	case request == "AT+NFWUPD=2":
+		return []string{"OK"}
+	case request == "AT+NFWUPD=5":
+		m.version = "SECURITY,V100R100C10B657SP3"
+		return []string{"OK", "REBOOT_CAUSE_APPLICATION_AT", "Neul", "OK"}
+	}
+	return []string{"ERROR"}
+}
+
+func TestDownloadFirmware(t *testing.T) {
+	defer func(size int) { FirmwareChunkSize = size }(FirmwareChunkSize)
+	FirmwareChunkSize = 4
+	firmware := []byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0xaa, 0x55}
+
+	m := &firmwareModule{fail: map[int]bool{1: true}}
+	port := newFakePort(m.answer)
+	defer port.Close()
+	var progress []int
+	if err := DownloadFirmware(port, firmware, func(sent, total int) {
+		progress = append(progress, sent)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if m.err != nil {
+		t.Fatal(m.err)
+	}
+	if !bytes.Equal(m.received.Bytes(), firmware) {
+		t.Errorf("module received %q, want %q", m.received.Bytes(), firmware)
+	}
+	want := []string{
+		"AT+NFWUPD=0",
+		"AT+NFWUPD=1,0,4,01020408,15",
+		"AT+NFWUPD=1,1,4,10204080,240",
+		"AT+NFWUPD=1,1,4,10204080,240",
+		"AT+NFWUPD=1,2,2,aa55,255",
+		"AT+NFWUPD=2",
+	}
+	if got := port.Requests(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if fmt.Sprint(progress) != "[4 8 10]" {
+		t.Errorf("progress %v, want [4 8 10]", progress)
+	}
+}
+
+func TestDownloadFirmwareGivesUp(t *testing.T) {
+	defer func(size int) { FirmwareChunkSize = size }(FirmwareChunkSize)
+	FirmwareChunkSize = 4
+	port := newFakePort(func(request string) []string {
+		if strings.HasPrefix(request, "AT+NFWUPD=1,") {
+			return []string{"ERROR"}
+		}
+		return []string{"OK"}
+	})
+	defer port.Close()
+	if err := DownloadFirmware(port, []byte("0123456789"), nil); err == nil {
+		t.Fatal("rejected chunk accepted")
+	}
+	if got := len(port.Requests()); got != 2+FirmwareRetries {
+		t.Errorf("%d requests, want the clear and %d tries", got, 1+FirmwareRetries)
+	}
+}
+
+func TestUpdateFirmware(t *testing.T) {
+	defer func(timeout time.Duration) { UpgradeTimeout = timeout }(UpgradeTimeout)
+	UpgradeTimeout = 5 * time.Second
+	m := &firmwareModule{version: "SECURITY,V100R100C10B657SP2"}
+	port := newFakePort(m.answer)
+	defer port.Close()
+
+	before, err := FirmwareVersion(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := UpdateFirmware(port, bytes.Repeat([]byte{0xa5}, 600), before, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != "SECURITY,V100R100C10B657SP3" {
+		t.Errorf("version after update %q", after)
+	}
+	versions := 0
+	for _, request := range port.Requests() {
+		if request == "ATi9" {
+			versions++
+		}
+	}
+	if versions != 2 {
+		t.Errorf("version read %d times, want 2", versions)
+	}
+
+	// the same version after the upgrade is an error
+	if _, err := UpdateFirmware(port, []byte{1}, after, nil); err == nil {
+		t.Error("unchanged version accepted")
+	}
+}
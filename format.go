@@ -0,0 +1,146 @@
+package senbiotpkg
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PayloadFormat converts readings written as JSON to a compact payload and back
+type PayloadFormat interface {
+	Name() string
+	// Encode turns the JSON text into the payload
+	Encode(data []byte) ([]byte, error)
+	// Decode turns the payload into JSON text
+	Decode(payload []byte) ([]byte, error)
+}
+
+var (
+	formatsMu sync.Mutex
+	formats   = make(map[string]PayloadFormat)
+	// formatOrder is the order in which the formats were registered
+	formatOrder []string
+)
+
+// RegisterFormat makes a payload format available by its name
+func RegisterFormat(f PayloadFormat) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if _, ok := formats[f.Name()]; !ok {
+		formatOrder = append(formatOrder, f.Name())
+	}
+	formats[f.Name()] = f
+}
+
+// FormatByName returns the registered payload format with the given name
+func FormatByName(name string) (PayloadFormat, error) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	f, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload format %s", name)
+	}
+	return f, nil
+}
+
+// FormatNames returns the names of the registered payload formats
+func FormatNames() []string {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectFormat returns the first format other than raw that can decode the
+// payload. The formats registered last are tried first, so a schema of the
+// application goes before the formats of the package, and SenML before the
+// CBOR it is written in.
+func DetectFormat(payload []byte) (PayloadFormat, error) {
+	formatsMu.Lock()
+	order := append([]string(nil), formatOrder...)
+	formatsMu.Unlock()
+	for i := len(order) - 1; i >= 0; i-- {
+		if order[i] == "raw" {
+			continue
+		}
+		f, err := FormatByName(order[i])
+		if err != nil {
+			continue
+		}
+		if _, err := f.Decode(payload); err == nil {
+			return f, nil
+		}
+	}
+	return nil, errors.New("format of payload not recognized")
+}
+
+// RenderPayload shows the payload as output asks: text in its format,
+// hexdump, a go or c byte array, json with the length and the payload in
+// base64, or pretty in its format, which is detected when format is raw. It
+// returns the format the payload is shown in.
+func RenderPayload(payload []byte, output string, format PayloadFormat) ([]byte, PayloadFormat, error) {
+	switch output {
+	case "text":
+		text, err := format.Decode(payload)
+		return text, format, err
+	case "hexdump":
+		return []byte(hex.Dump(payload)), format, nil
+	case "go":
+		return []byte("[]byte{" + byteLiterals(payload, "\t") + "}\n"), format, nil
+	case "c":
+		return []byte(fmt.Sprintf("unsigned char payload[%d] = {%s};\n", len(payload), byteLiterals(payload, "    "))), format, nil
+	case "json":
+		j, err := json.Marshal(struct {
+			Length int    `json:"length"`
+			Base64 []byte `json:"base64"`
+		}{len(payload), payload})
+		return append(j, '\n'), format, err
+	case "pretty":
+		if format.Name() == "raw" {
+			detected, err := DetectFormat(payload)
+			if err != nil {
+				return nil, format, err
+			}
+			format = detected
+		}
+		text, err := format.Decode(payload)
+		return text, format, err
+	}
+	return nil, format, fmt.Errorf("unknown output %s", output)
+}
+
+// byteLiterals writes the payload as 0x.. literals, 12 on a line
+func byteLiterals(payload []byte, indent string) string {
+	var b strings.Builder
+	for i, c := range payload {
+		if i%12 == 0 {
+			b.WriteString("\n" + indent)
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "0x%02x,", c)
+	}
+	if len(payload) != 0 {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// rawFormat passes the payload unchanged
+type rawFormat struct{}
+
+func (rawFormat) Name() string                          { return "raw" }
+func (rawFormat) Encode(data []byte) ([]byte, error)    { return data, nil }
+func (rawFormat) Decode(payload []byte) ([]byte, error) { return payload, nil }
+
+func init() {
+	RegisterFormat(rawFormat{})
+}
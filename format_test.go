@@ -0,0 +1,65 @@
+package senbiotpkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestByteLiterals(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		want    string
+	}{
+		{nil, ""},
+		{[]byte{0x48, 0x00, 0xff}, "\n\t0x48, 0x00, 0xff,\n"},
+		{make([]byte, 13), "\n\t" + strings.Repeat("0x00, ", 11) + "0x00,\n\t0x00,\n"},
+	}
+	for _, test := range tests {
+		if got := byteLiterals(test.payload, "\t"); got != test.want {
+			t.Errorf("byteLiterals(%x) = %q, want %q", test.payload, got, test.want)
+		}
+	}
+}
+
+func TestRenderPayload(t *testing.T) {
+	raw, _ := FormatByName("raw")
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"text", "Hi"},
+		{"hexdump", "00000000  48 69                                             |Hi|\n"},
+		{"go", "[]byte{\n\t0x48, 0x69,\n}\n"},
+		{"c", "unsigned char payload[2] = {\n    0x48, 0x69,\n};\n"},
+		{"json", `{"length":2,"base64":"SGk="}` + "\n"},
+	}
+	for _, test := range tests {
+		got, format, err := RenderPayload([]byte("Hi"), test.output, raw)
+		if err != nil || string(got) != test.want || format != raw {
+			t.Errorf("RenderPayload(%s) = %q, %v, %v, want %q", test.output, got, format.Name(), err, test.want)
+		}
+	}
+	if _, _, err := RenderPayload([]byte("Hi"), "yaml", raw); err == nil {
+		t.Error("RenderPayload with an unknown output succeeded")
+	}
+}
+
+func TestRenderPayloadPretty(t *testing.T) {
+	raw, _ := FormatByName("raw")
+	cbor, _ := FormatByName("cbor")
+	payload, err := cbor.Encode([]byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, format, err := RenderPayload(payload, "pretty", raw)
+	if want := "{\n  \"a\": 1\n}"; err != nil || format.Name() != "cbor" || string(got) != want {
+		t.Errorf("RenderPayload(pretty) = %q in %s, %v, want %q in cbor", got, format.Name(), err, want)
+	}
+	// a given format is not detected
+	if _, format, _ := RenderPayload(payload, "pretty", cbor); format != cbor {
+		t.Errorf("RenderPayload(pretty, cbor) shown in %s", format.Name())
+	}
+	if _, _, err := RenderPayload([]byte{0xff}, "pretty", raw); err == nil {
+		t.Error("RenderPayload(pretty) of an unknown payload succeeded")
+	}
+}
@@ -0,0 +1,216 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxPayload is the largest message in bytes each transport accepts: CDP
+// (AT+NMGS, AT+QLWULDATA) takes 512 bytes, a UDP socket (AT+NSOST) about 1358
+var MaxPayload = map[string]int{
+	"cdp": 512,
+	"udp": 1358,
+}
+
+// Transport returns how the setup sends messages, cdp or udp
+func Transport(c Setup) string {
+	if strings.HasPrefix(c.SendMessageString, "AT+NSOST") {
+		return "udp"
+	}
+	return "cdp"
+}
+
+// MaxPayloadSize returns the largest message the setup can send
+func MaxPayloadSize(c Setup) int {
+	return MaxPayload[Transport(c)]
+}
+
+// PayloadSizeError is returned for a message that is too large for its transport
+type PayloadSizeError struct {
+	Size      int
+	Max       int
+	Transport string
+}
+
+func (e *PayloadSizeError) Error() string {
+	return fmt.Sprintf("message of %d bytes is larger than the %d bytes %s allows, send it in fragments", e.Size, e.Max, e.Transport)
+}
+
+// CheckPayloadSize returns a *PayloadSizeError when a message of size bytes
+// does not fit the transport of the setup
+func CheckPayloadSize(c Setup, size int) error {
+	if max := MaxPayloadSize(c); size > max {
+		return &PayloadSizeError{Size: size, Max: max, Transport: Transport(c)}
+	}
+	return nil
+}
+
+// A fragment starts with FragmentMarker, the message id (2 bytes, big
+// endian), the index of the fragment and the number of fragments
+const (
+	FragmentMarker     = 0xfa
+	FragmentHeaderSize = 5
+)
+
+var (
+	messageIDMu sync.Mutex
+	messageID   = uint16(time.Now().UnixNano())
+)
+
+// NextMessageID returns the id for the next fragmented message
+func NextMessageID() uint16 {
+	messageIDMu.Lock()
+	defer messageIDMu.Unlock()
+	messageID++
+	return messageID
+}
+
+// Fragment splits the message in fragments of at most max bytes, header included
+func Fragment(messagebyte []byte, id uint16, max int) ([][]byte, error) {
+	size := max - FragmentHeaderSize
+	if size < 1 {
+		return nil, fmt.Errorf("fragments of %d bytes leave no room for data", max)
+	}
+	count := (len(messagebyte) + size - 1) / size
+	if count == 0 {
+		count = 1
+	}
+	if count > 255 {
+		return nil, fmt.Errorf("message of %d bytes needs more than 255 fragments", len(messagebyte))
+	}
+	fragments := make([][]byte, count)
+	for i := range fragments {
+		end := (i + 1) * size
+		if end > len(messagebyte) {
+			end = len(messagebyte)
+		}
+		f := []byte{FragmentMarker, byte(id >> 8), byte(id), byte(i), byte(count)}
+		fragments[i] = append(f, messagebyte[i*size:end]...)
+	}
+	return fragments, nil
+}
+
+// Fragments splits the message for the transport of the setup with a new message id
+func Fragments(c Setup, messagebyte []byte) ([][]byte, error) {
+	return Fragment(messagebyte, NextMessageID(), MaxPayloadSize(c))
+}
+
+// IsFragment reports whether the payload starts with a fragment header
+func IsFragment(payload []byte) bool {
+	return len(payload) >= FragmentHeaderSize && payload[0] == FragmentMarker &&
+		payload[4] != 0 && payload[3] < payload[4]
+}
+
+// Reassembler puts fragmented messages together on the receiving side
+type Reassembler struct {
+	// Timeout is how long the fragments of an incomplete message, and the
+	// id of a completed one, are kept
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	messages  map[messageKey]*partialMessage
+	completed map[messageKey]time.Time
+}
+
+// messageKey is a message id of a source, as devices choose their ids independently
+type messageKey struct {
+	source string
+	id     uint16
+}
+
+type partialMessage struct {
+	fragments [][]byte
+	have      []bool
+	received  int
+	started   time.Time
+}
+
+// NewReassembler returns a reassembler that drops incomplete messages after
+// timeout, which must be larger than 0
+func NewReassembler(timeout time.Duration) (*Reassembler, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("reassembly timeout %v is not larger than 0", timeout)
+	}
+	return &Reassembler{Timeout: timeout}, nil
+}
+
+// ErrNoFragment is returned by Add for a payload without fragment header
+var ErrNoFragment = errors.New("payload has no fragment header")
+
+// Add adds a fragment received from source, eg the device id or address,
+// and returns the message when it is complete. Messages of different
+// sources are kept apart, also when they have the same id. Fragments may
+// arrive in any order, duplicates are ignored, also when they arrive within
+// Timeout after their message was completed.
+func (r *Reassembler) Add(source string, fragment []byte) ([]byte, bool, error) {
+	if !IsFragment(fragment) {
+		return nil, false, ErrNoFragment
+	}
+	id := uint16(fragment[1])<<8 | uint16(fragment[2])
+	key := messageKey{source, id}
+	index, count := int(fragment[3]), int(fragment[4])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Timeout <= 0 {
+		return nil, false, fmt.Errorf("reassembly timeout %v is not larger than 0", r.Timeout)
+	}
+	if r.messages == nil {
+		r.messages = make(map[messageKey]*partialMessage)
+		r.completed = make(map[messageKey]time.Time)
+	}
+	r.expire()
+	if _, done := r.completed[key]; done {
+		return nil, false, nil
+	}
+	m, ok := r.messages[key]
+	if !ok {
+		m = &partialMessage{fragments: make([][]byte, count), have: make([]bool, count), started: time.Now()}
+		r.messages[key] = m
+	}
+	if len(m.fragments) != count {
+		delete(r.messages, key)
+		return nil, false, fmt.Errorf("fragment %d of message %d of %s says %d fragments instead of %d", index, id, source, count, len(m.fragments))
+	}
+	if !m.have[index] {
+		m.fragments[index] = append([]byte(nil), fragment[FragmentHeaderSize:]...)
+		m.have[index] = true
+		m.received++
+	}
+	if m.received < count {
+		return nil, false, nil
+	}
+	delete(r.messages, key)
+	r.completed[key] = time.Now()
+	var message []byte
+	for _, f := range m.fragments {
+		message = append(message, f...)
+	}
+	return message, true, nil
+}
+
+// expire drops the messages that did not complete within the timeout and
+// forgets the ids of messages completed longer ago
+func (r *Reassembler) expire() {
+	for key, m := range r.messages {
+		if time.Since(m.started) > r.Timeout {
+			delete(r.messages, key)
+		}
+	}
+	for key, at := range r.completed {
+		if time.Since(at) > r.Timeout {
+			delete(r.completed, key)
+		}
+	}
+}
+
+// Pending returns the number of incomplete messages
+func (r *Reassembler) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	return len(r.messages)
+}
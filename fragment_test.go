@@ -0,0 +1,301 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	cdpSetup = Setup{SendMessageString: "AT+NMGS="}
+	udpSetup = Setup{SendMessageString: "AT+NSOST=0,\"10.0.0.1\",5683,"}
+)
+
+func TestCheckPayloadSize(t *testing.T) {
+	tests := []struct {
+		setup Setup
+		size  int
+		ok    bool
+	}{
+		{cdpSetup, 512, true},
+		{cdpSetup, 513, false},
+		{udpSetup, 1358, true},
+		{udpSetup, 1359, false},
+	}
+	for _, test := range tests {
+		err := CheckPayloadSize(test.setup, test.size)
+		if (err == nil) != test.ok {
+			t.Errorf("CheckPayloadSize(%s, %d) = %v", Transport(test.setup), test.size, err)
+		}
+		if err != nil {
+			if _, ok := err.(*PayloadSizeError); !ok {
+				t.Errorf("CheckPayloadSize(%s, %d) = %T, want *PayloadSizeError", Transport(test.setup), test.size, err)
+			}
+		}
+	}
+}
+
+func TestFragment(t *testing.T) {
+	tests := []struct {
+		size      int
+		max       int
+		fragments []int
+	}{
+		{0, 10, []int{5}},
+		{5, 10, []int{10}},
+		{6, 10, []int{10, 6}},
+		{15, 10, []int{10, 10, 10}},
+		{1200, 512, []int{512, 512, 191}},
+	}
+	for _, test := range tests {
+		message := bytes.Repeat([]byte{0x42}, test.size)
+		fragments, err := Fragment(message, 0x1234, test.max)
+		if err != nil {
+			t.Errorf("Fragment(%d bytes, %d): %v", test.size, test.max, err)
+			continue
+		}
+		if len(fragments) != len(test.fragments) {
+			t.Errorf("Fragment(%d bytes, %d) = %d fragments, want %d", test.size, test.max, len(fragments), len(test.fragments))
+			continue
+		}
+		for i, f := range fragments {
+			if len(f) != test.fragments[i] {
+				t.Errorf("Fragment(%d bytes, %d) fragment %d is %d bytes, want %d", test.size, test.max, i, len(f), test.fragments[i])
+			}
+			header := []byte{FragmentMarker, 0x12, 0x34, byte(i), byte(len(fragments))}
+			if !bytes.Equal(f[:FragmentHeaderSize], header) || !IsFragment(f) {
+				t.Errorf("Fragment(%d bytes, %d) fragment %d header % x, want % x", test.size, test.max, i, f[:FragmentHeaderSize], header)
+			}
+		}
+	}
+
+	if _, err := Fragment([]byte("message"), 1, FragmentHeaderSize); err == nil {
+		t.Error("Fragment without room for data succeeded")
+	}
+	if _, err := Fragment(make([]byte, 256), 1, FragmentHeaderSize+1); err == nil {
+		t.Error("Fragment in 256 fragments succeeded")
+	}
+}
+
+func TestIsFragment(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		want    bool
+	}{
+		{[]byte{0xfa, 0, 1, 0, 2}, true},
+		{[]byte{0xfa, 0, 1, 1, 2, 'x'}, true},
+		{[]byte{0xfa, 0, 1, 2, 2}, false},
+		{[]byte{0xfa, 0, 1, 0, 0}, false},
+		{[]byte{0xfa, 0, 1, 0}, false},
+		{[]byte{0xb1, 0, 0, 0, 0, 1}, false},
+	}
+	for _, test := range tests {
+		if got := IsFragment(test.payload); got != test.want {
+			t.Errorf("IsFragment(% x) = %v, want %v", test.payload, got, test.want)
+		}
+	}
+}
+
+func TestReassembler(t *testing.T) {
+	message := []byte("a message that does not fit in a single fragment")
+	fragments, err := Fragment(message, 7, 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReassembler(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// out of order, with a duplicate
+	order := []int{3, 1, 1, 0, 2}
+	for i, index := range order {
+		got, complete, err := r.Add("device 1", fragments[index])
+		if err != nil {
+			t.Fatalf("Add fragment %d: %v", index, err)
+		}
+		if last := i == len(order)-1; complete != last {
+			t.Fatalf("Add fragment %d complete = %v, want %v", index, complete, last)
+		}
+		if complete && !bytes.Equal(got, message) {
+			t.Errorf("reassembled %q, want %q", got, message)
+		}
+	}
+	if n := r.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after the message completed, want 0", n)
+	}
+	// a late duplicate of the completed message is ignored
+	if _, complete, err := r.Add("device 1", fragments[2]); complete || err != nil {
+		t.Errorf("Add late duplicate = %v, %v", complete, err)
+	}
+	if n := r.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after a late duplicate, want 0", n)
+	}
+
+	if _, _, err := r.Add("device 1", []byte("no fragment")); err != ErrNoFragment {
+		t.Errorf("Add without header = %v, want ErrNoFragment", err)
+	}
+	r.Add("device 1", []byte{FragmentMarker, 0, 8, 0, 2, 'a'})
+	if _, _, err := r.Add("device 1", []byte{FragmentMarker, 0, 8, 1, 3, 'b'}); err == nil {
+		t.Error("Add with another fragment count succeeded")
+	}
+	if n := r.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after a fragment count mismatch, want 0", n)
+	}
+}
+
+func TestReassemblerSources(t *testing.T) {
+	r, err := NewReassembler(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two devices send a message with the same id at the same time
+	first, _ := Fragment([]byte("first device"), 7, 10)
+	second, _ := Fragment([]byte("second device"), 7, 10)
+	r.Add("device 1", first[0])
+	r.Add("device 2", second[0])
+	if n := r.Pending(); n != 2 {
+		t.Errorf("Pending() = %d, want 2", n)
+	}
+	for _, test := range []struct {
+		source    string
+		fragments [][]byte
+		want      string
+	}{
+		{"device 2", second, "second device"},
+		{"device 1", first, "first device"},
+	} {
+		var got []byte
+		var complete bool
+		for _, f := range test.fragments[1:] {
+			if got, complete, err = r.Add(test.source, f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !complete || string(got) != test.want {
+			t.Errorf("%s: reassembled %q, %v, want %q", test.source, got, complete, test.want)
+		}
+	}
+	// a completed id of one device does not block the same id of another
+	third, _ := Fragment([]byte("third"), 7, 10)
+	if got, complete, _ := r.Add("device 3", third[0]); !complete || string(got) != "third" {
+		t.Errorf("device 3: reassembled %q, %v", got, complete)
+	}
+}
+
+func TestReassemblerExpires(t *testing.T) {
+	r, err := NewReassembler(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Add("device 1", []byte{FragmentMarker, 0, 1, 0, 2, 'a'})
+	if _, complete, _ := r.Add("device 1", []byte{FragmentMarker, 0, 2, 0, 1, 'b'}); !complete {
+		t.Fatal("single fragment did not complete")
+	}
+	if n := r.Pending(); n != 1 {
+		t.Fatalf("Pending() = %d, want 1", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := r.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after the timeout, want 0", n)
+	}
+	// the completed id is forgotten after the timeout and can be used again
+	if _, complete, _ := r.Add("device 1", []byte{FragmentMarker, 0, 2, 0, 1, 'c'}); !complete {
+		t.Error("message id was not reusable after the timeout")
+	}
+}
+
+func TestReassemblerNeedsTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if _, err := NewReassembler(timeout); err == nil {
+			t.Errorf("NewReassembler(%v) succeeded", timeout)
+		}
+	}
+	var r Reassembler
+	if _, _, err := r.Add("device 1", []byte{FragmentMarker, 0, 1, 0, 1, 'a'}); err == nil {
+		t.Error("Add without timeout succeeded")
+	}
+}
+
+func TestPreparePayload(t *testing.T) {
+	dir := t.TempDir()
+	small := []byte("fits")
+	large := bytes.Repeat([]byte("0123456789"), 60)
+
+	payloads, err := PreparePayload(cdpSetup, small, PayloadOptions{Fragment: true})
+	if err != nil || len(payloads) != 1 || !bytes.Equal(payloads[0], small) {
+		t.Errorf("PreparePayload(small, fragment) = % x, %v, want the message without fragment header", payloads, err)
+	}
+
+	if _, err := PreparePayload(cdpSetup, large, PayloadOptions{}); err == nil {
+		t.Error("PreparePayload(large) succeeded without fragment")
+	} else if _, ok := err.(*PayloadSizeError); !ok {
+		t.Errorf("PreparePayload(large) = %T, want *PayloadSizeError", err)
+	}
+
+	payloads, err = PreparePayload(cdpSetup, large, PayloadOptions{Fragment: true})
+	if err != nil || len(payloads) != 2 {
+		t.Fatalf("PreparePayload(large, fragment) = %d payloads, %v, want 2", len(payloads), err)
+	}
+	r, _ := NewReassembler(time.Minute)
+	r.Add("device 1", payloads[0])
+	if got, complete, _ := r.Add("device 1", payloads[1]); !complete || !bytes.Equal(got, large) {
+		t.Error("fragments of PreparePayload do not reassemble to the message")
+	}
+
+	opts := PayloadOptions{
+		Envelope:     true,
+		SequenceFile: filepath.Join(dir, "sequence.counter"),
+		Type:         3,
+		HasType:      true,
+		Compress:     "deflate",
+	}
+	for want := uint32(1); want <= 2; want++ {
+		payloads, err = PreparePayload(cdpSetup, large, opts)
+		if err != nil || len(payloads) != 1 {
+			t.Fatalf("PreparePayload(envelope, deflate) = %d payloads, %v", len(payloads), err)
+		}
+		decompressed, ok := Decompress(payloads[0])
+		if !ok {
+			t.Fatal("PreparePayload(envelope, deflate) is not compressed")
+		}
+		e, err := ParseEnvelope(decompressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Sequence != want || !e.HasType || e.Type != 3 || !bytes.Equal(e.Payload, large) {
+			t.Errorf("PreparePayload envelope %v with %d bytes, want sequence %d, type 3 and %d bytes", e, len(e.Payload), want, len(large))
+		}
+	}
+
+	if _, err := PreparePayload(cdpSetup, small, PayloadOptions{Compress: "zip"}); err == nil {
+		t.Error("PreparePayload with unknown compression succeeded")
+	}
+}
+
+func TestUnwrapPayload(t *testing.T) {
+	opts := PayloadOptions{Envelope: true, SequenceFile: filepath.Join(t.TempDir(), "sequence"), Compress: "lz"}
+	payloads, err := PreparePayload(cdpSetup, []byte("abcabcabc"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := UnwrapPayload(payloads[0], true, true)
+	if err != nil || e.Sequence != 1 || string(e.Payload) != "abcabcabc" {
+		t.Errorf("UnwrapPayload = %v %q, %v", e, e.Payload, err)
+	}
+	if _, err := UnwrapPayload(payloads[0], false, true); err == nil {
+		t.Error("UnwrapPayload found the envelope without decompressing")
+	}
+
+	// raw payloads that start with the header byte of a compression are
+	// only decompressed when asked
+	for _, raw := range []string{"d00300", "d100010042"} {
+		e, err := UnwrapPayload(unhex(t, raw), false, false)
+		if err != nil || !bytes.Equal(e.Payload, unhex(t, raw)) {
+			t.Errorf("UnwrapPayload(%s) = %x, %v, want it unchanged", raw, e.Payload, err)
+		}
+	}
+	if _, err := UnwrapPayload([]byte("Hello"), true, false); err == nil {
+		t.Error("UnwrapPayload decompressed an uncompressed payload")
+	}
+}
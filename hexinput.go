@@ -0,0 +1,203 @@
+package senbiotpkg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HexError tells where hex input is invalid. Pos is the byte offset in Input,
+// -1 when the error is not at one position.
+type HexError struct {
+	Input  string
+	Pos    int
+	Reason string
+}
+
+func (e *HexError) Error() string {
+	if e.Pos < 0 {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s at position %d", e.Reason, e.Pos+1)
+}
+
+// Marker returns the input with a line below it that points at the invalid position
+func (e *HexError) Marker() string {
+	if e.Pos < 0 || e.Pos > len(e.Input) {
+		return e.Input
+	}
+	return e.Input + "\n" + strings.Repeat(" ", e.Pos) + "^"
+}
+
+// atPrefix matches a command or answer in front of the data, eg +NNMI:,
+// AT+NMGS= or AT+NSORF answers as +NSORF:
+var atPrefix = regexp.MustCompile(`^(?i:AT)?\+[A-Za-z0-9]+\s*[:=]\s*`)
+
+// ParseHex decodes hex as it is copied from logs and terminals. It strips an
+// AT command or answer prefix like +NNMI: with its length and other fields,
+// white space, the separators : - , . and 0x prefixes. A declared length
+// must match the data, in bytes or in hex digits. Without a prefix a leading
+// field is only taken as the length when the input is not hex as a whole.
+func ParseHex(input []byte) ([]byte, error) {
+	s := string(input)
+	if len(strings.TrimSpace(s)) == 0 {
+		return nil, nil
+	}
+	start := 0
+	// skip leading white space and the prefix, keep the offsets into input
+	for start < len(s) && strings.ContainsRune(" \t\r\n", rune(s[start])) {
+		start++
+	}
+	if m := atPrefix.FindStringIndex(s[start:]); m != nil {
+		start += m[1]
+		fields := splitFields(s, start)
+		if len(fields) > 1 {
+			return parseDataField(s, fields)
+		}
+	}
+	end := len(strings.TrimRight(s, " \t\r\n"))
+	if end < start {
+		end = start
+	}
+	if fields := splitFields(s, start); len(fields) > 1 && !byteList(s, fields) {
+		// parameters copied without their prefix, as 5,48656C6C6F. When all
+		// of the input is hex as well, as 02,0304, the first field can be a
+		// length or the first byte.
+		if data, err := parseDataField(s, fields); err == nil {
+			if _, err := parseHexDigits(s, start, end); err == nil {
+				return nil, &HexError{Input: s, Pos: fields[0].start,
+					Reason: "length or data, add the AT prefix or leave out the length"}
+			}
+			return data, nil
+		}
+	}
+	return parseHexDigits(s, start, end)
+}
+
+// field is a comma separated parameter of an AT line, as offsets into the input
+type field struct {
+	start, end int
+}
+
+func (f field) text(s string) string {
+	return strings.Trim(strings.TrimSpace(s[f.start:f.end]), "\"")
+}
+
+func splitFields(s string, start int) []field {
+	var fields []field
+	for i := start; i <= len(s); i++ {
+		if i == len(s) || s[i] == ',' {
+			fields = append(fields, field{start, i})
+			start = i + 1
+		}
+	}
+	return fields
+}
+
+// byteList reports whether the fields are single bytes, as 48,65,6C
+func byteList(s string, fields []field) bool {
+	for _, f := range fields {
+		t := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s[f.start:f.end]), "0x"), "0X")
+		if len(t) > 2 {
+			return false
+		}
+	}
+	return true
+}
+
+func isDecimal(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// parseDataField finds the data among the parameters of an AT line: the
+// field after a decimal length. The field whose length matches is taken,
+// otherwise the longest one, and the mismatch is reported.
+func parseDataField(s string, fields []field) ([]byte, error) {
+	best, bestLength := -1, 0
+	for i := 1; i < len(fields); i++ {
+		length := fields[i-1].text(s)
+		data := fields[i].text(s)
+		if !isDecimal(length) || len(data) == 0 {
+			continue
+		}
+		n, _ := strconv.Atoi(length)
+		// a field of an odd number of digits, as the 0 of 1,0,5, is no data
+		if (n == len(data)/2 || n == len(data)) && len(data)%2 == 0 {
+			best, bestLength = i, n
+			break
+		}
+		if best < 0 || len(data) > len(fields[best].text(s)) {
+			best, bestLength = i, n
+		}
+	}
+	if best < 0 {
+		return nil, &HexError{Input: s, Pos: -1, Reason: "no length and data found after the AT prefix"}
+	}
+	f := fields[best]
+	// the offsets of the data without spaces and quotes
+	for f.start < f.end && strings.ContainsRune(" \t\"", rune(s[f.start])) {
+		f.start++
+	}
+	for f.end > f.start && strings.ContainsRune(" \t\r\n\"", rune(s[f.end-1])) {
+		f.end--
+	}
+	data, err := parseHexDigits(s, f.start, f.end)
+	if err != nil {
+		return nil, err
+	}
+	if bestLength != len(data) && bestLength != 2*len(data) {
+		return nil, &HexError{Input: s, Pos: fields[best-1].start,
+			Reason: fmt.Sprintf("declared length %d does not match the %d bytes of data", bestLength, len(data))}
+	}
+	return data, nil
+}
+
+// parseHexDigits decodes s[start:end], skipping separators and 0x prefixes
+func parseHexDigits(s string, start, end int) ([]byte, error) {
+	var digits []byte
+	var positions []int
+	for i := start; i < end; i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(" \t\r\n:-,.", c) >= 0:
+			continue
+		case c == '0' && i+1 < end && (s[i+1] == 'x' || s[i+1] == 'X') &&
+			(i == start || strings.IndexByte(" \t\r\n:-,.", s[i-1]) >= 0):
+			i++
+			continue
+		case c == '\\' && i+1 < end && s[i+1] == 'x':
+			i++
+			continue
+		case !isHexDigit(c):
+			return nil, &HexError{Input: s, Pos: i, Reason: fmt.Sprintf("invalid hex character %q", c)}
+		}
+		digits = append(digits, c)
+		positions = append(positions, i)
+	}
+	if len(digits) == 0 {
+		return nil, &HexError{Input: s, Pos: -1, Reason: "no hex digits"}
+	}
+	if len(digits)%2 != 0 {
+		return nil, &HexError{Input: s, Pos: positions[len(positions)-1],
+			Reason: fmt.Sprintf("odd number of hex digits (%d), the last one has no partner", len(digits))}
+	}
+	data := make([]byte, len(digits)/2)
+	for i := range data {
+		v, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		data[i] = byte(v)
+	}
+	return data, nil
+}
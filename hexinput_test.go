@@ -0,0 +1,83 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseHex(t *testing.T) {
+	hello := []byte("Hello")
+	tests := []struct {
+		input string
+		want  []byte
+	}{
+		{"48656C6C6F", hello},
+		{"48656c6c6f\r\n", hello},
+		{"  48 65 6c 6c 6f  ", hello},
+		{"48:65:6C:6C:6F", hello},
+		{"48-65-6c-6c-6f", hello},
+		{"4865.6c6c.6f", hello},
+		{"0x48,0x65,0x6c,0x6c,0x6f", hello},
+		{"0x48656c6c6f", hello},
+		{`\x48\x65\x6c\x6c\x6f`, hello},
+		{"48,65,6C,6C,6F", hello},
+		{"+NNMI:5,48656C6C6F", hello},
+		{"+NNMI: 5, 48656C6C6F", hello},
+		{"AT+NMGS=5,48656C6C6F", hello},
+		// the NMGS of the u-blox setups has the length in hex digits
+		{"AT+NMGS=10,48656C6C6F", hello},
+		{"at+nmgs=5,\"48656C6C6F\"", hello},
+		{"+NSORF:0,10.0.0.1,5683,5,48656C6C6F,0", hello},
+		{"+QLWDATARECV: 19,1,0,5,48656C6C6F", hello},
+		{"5,48656C6C6F", hello},
+		{"01,ff", []byte{0x01, 0xff}},
+		{"1,0,5,48656C6C6F", hello},
+		{"00", []byte{0}},
+		{"", nil},
+		{" \r\n", nil},
+	}
+	for _, test := range tests {
+		got, err := ParseHex([]byte(test.input))
+		if err != nil {
+			t.Errorf("ParseHex(%q): %v", test.input, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("ParseHex(%q) = %x, want %x", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseHexErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		pos    int
+		marker string
+	}{
+		{"48g5", 2, "48g5\n  ^"},
+		{"48656", 4, "48656\n    ^"},
+		{"48 65 6", 6, "48 65 6\n      ^"},
+		{"+NNMI:4,48656C6C6F", 6, "+NNMI:4,48656C6C6F\n      ^"},
+		{"+NNMI:5,4865zz6C6F", 12, "+NNMI:5,4865zz6C6F\n            ^"},
+		{"+NNMI:abc", 8, "+NNMI:abc\n        ^"},
+		{"+NNMI:x,y", -1, "+NNMI:x,y"},
+		{"0x", -1, "0x"},
+		// 02 can be the length of 0304 or its first byte
+		{"02,0304", 0, "02,0304\n^"},
+		{"+NNMI:3,0203", 6, "+NNMI:3,0203\n      ^"},
+	}
+	for _, test := range tests {
+		_, err := ParseHex([]byte(test.input))
+		hexErr, ok := err.(*HexError)
+		if !ok {
+			t.Errorf("ParseHex(%q) = %v, want a *HexError", test.input, err)
+			continue
+		}
+		if hexErr.Pos != test.pos {
+			t.Errorf("ParseHex(%q) error at %d (%v), want %d", test.input, hexErr.Pos, hexErr, test.pos)
+		}
+		if got := hexErr.Marker(); got != test.marker {
+			t.Errorf("ParseHex(%q) marker\n%s\nwant\n%s", test.input, got, test.marker)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package senbiotpkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Cayenne Low Power Payload, a channel byte, a type byte and the value of
+// each reading, see https://mydevices.com/cayenne/docs/lora/#lora-cayenne-low-power-payload
+
+func init() {
+	RegisterFormat(lppFormat{})
+}
+
+// lppFormat is Cayenne LPP as payload format
+type lppFormat struct{}
+
+func (lppFormat) Name() string                          { return "lpp" }
+func (lppFormat) Encode(data []byte) ([]byte, error)    { return EncodeLPPJSON(data) }
+func (lppFormat) Decode(payload []byte) ([]byte, error) { return DecodeLPPJSON(payload) }
+
+type lppField struct {
+	name   string
+	size   int
+	scale  float64
+	signed bool
+}
+
+type lppType struct {
+	id     byte
+	name   string
+	fields []lppField
+}
+
+var lppTypes = []lppType{
+	{0, "digital_input", []lppField{{"", 1, 1, false}}},
+	{1, "digital_output", []lppField{{"", 1, 1, false}}},
+	{2, "analog_input", []lppField{{"", 2, 100, true}}},
+	{3, "analog_output", []lppField{{"", 2, 100, true}}},
+	{101, "illuminance", []lppField{{"", 2, 1, false}}},
+	{102, "presence", []lppField{{"", 1, 1, false}}},
+	{103, "temperature", []lppField{{"", 2, 10, true}}},
+	{104, "humidity", []lppField{{"", 1, 2, false}}},
+	{113, "accelerometer", []lppField{{"x", 2, 1000, true}, {"y", 2, 1000, true}, {"z", 2, 1000, true}}},
+	{115, "barometer", []lppField{{"", 2, 10, false}}},
+	{134, "gyrometer", []lppField{{"x", 2, 100, true}, {"y", 2, 100, true}, {"z", 2, 100, true}}},
+	{136, "gps", []lppField{{"lat", 3, 10000, true}, {"lon", 3, 10000, true}, {"alt", 3, 100, true}}},
+}
+
+func lppTypeByName(name string) (lppType, bool) {
+	for _, t := range lppTypes {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return lppType{}, false
+}
+
+func lppTypeByID(id byte) (lppType, bool) {
+	for _, t := range lppTypes {
+		if t.id == id {
+			return t, true
+		}
+	}
+	return lppType{}, false
+}
+
+// LPPValue is a reading on a channel. Value is a number, or for the
+// accelerometer, gyrometer and GPS a map with x, y, z or lat, lon, alt.
+type LPPValue struct {
+	Channel uint8       `json:"channel"`
+	Type    string      `json:"type"`
+	Value   interface{} `json:"value"`
+}
+
+// LPPEncoder builds a Cayenne LPP payload
+type LPPEncoder struct {
+	buf []byte
+	err error
+}
+
+// NewLPPEncoder returns an empty LPP payload
+func NewLPPEncoder() *LPPEncoder {
+	return &LPPEncoder{}
+}
+
+func (e *LPPEncoder) add(channel uint8, typeName string, values ...float64) *LPPEncoder {
+	if e.err != nil {
+		return e
+	}
+	t, ok := lppTypeByName(typeName)
+	if !ok {
+		e.err = fmt.Errorf("unknown LPP type %s", typeName)
+		return e
+	}
+	if len(values) != len(t.fields) {
+		e.err = fmt.Errorf("LPP type %s needs %d values", typeName, len(t.fields))
+		return e
+	}
+	e.buf = append(e.buf, channel, t.id)
+	for i, f := range t.fields {
+		v := int64(math.Round(values[i] * f.scale))
+		bits := uint(f.size * 8)
+		min, max := int64(0), int64(1)<<bits-1
+		if f.signed {
+			min, max = -(int64(1) << (bits - 1)), int64(1)<<(bits-1)-1
+		}
+		if v < min || v > max {
+			e.err = fmt.Errorf("LPP %s value %v out of range on channel %d", typeName, values[i], channel)
+			return e
+		}
+		for b := f.size - 1; b >= 0; b-- {
+			e.buf = append(e.buf, byte(v>>(uint(b)*8)))
+		}
+	}
+	return e
+}
+
+func (e *LPPEncoder) AddDigitalInput(channel uint8, v uint8) *LPPEncoder {
+	return e.add(channel, "digital_input", float64(v))
+}
+
+func (e *LPPEncoder) AddDigitalOutput(channel uint8, v uint8) *LPPEncoder {
+	return e.add(channel, "digital_output", float64(v))
+}
+
+func (e *LPPEncoder) AddAnalogInput(channel uint8, v float64) *LPPEncoder {
+	return e.add(channel, "analog_input", v)
+}
+
+func (e *LPPEncoder) AddAnalogOutput(channel uint8, v float64) *LPPEncoder {
+	return e.add(channel, "analog_output", v)
+}
+
+func (e *LPPEncoder) AddIlluminance(channel uint8, lux float64) *LPPEncoder {
+	return e.add(channel, "illuminance", lux)
+}
+
+func (e *LPPEncoder) AddPresence(channel uint8, v uint8) *LPPEncoder {
+	return e.add(channel, "presence", float64(v))
+}
+
+// AddTemperature adds a temperature in °C, with 0.1 °C resolution
+func (e *LPPEncoder) AddTemperature(channel uint8, celsius float64) *LPPEncoder {
+	return e.add(channel, "temperature", celsius)
+}
+
+// AddHumidity adds a relative humidity in %, with 0.5 % resolution
+func (e *LPPEncoder) AddHumidity(channel uint8, percent float64) *LPPEncoder {
+	return e.add(channel, "humidity", percent)
+}
+
+// AddAccelerometer adds an acceleration in G
+func (e *LPPEncoder) AddAccelerometer(channel uint8, x, y, z float64) *LPPEncoder {
+	return e.add(channel, "accelerometer", x, y, z)
+}
+
+// AddBarometer adds a pressure in hPa
+func (e *LPPEncoder) AddBarometer(channel uint8, hpa float64) *LPPEncoder {
+	return e.add(channel, "barometer", hpa)
+}
+
+// AddGyrometer adds a rotation in °/s
+func (e *LPPEncoder) AddGyrometer(channel uint8, x, y, z float64) *LPPEncoder {
+	return e.add(channel, "gyrometer", x, y, z)
+}
+
+// AddGPS adds a position in degrees and an altitude in meters
+func (e *LPPEncoder) AddGPS(channel uint8, lat, lon, alt float64) *LPPEncoder {
+	return e.add(channel, "gps", lat, lon, alt)
+}
+
+// Add adds a value as decoded from JSON. A missing value, or a field of it
+// that is missing or not a number, is an error that names the field.
+func (e *LPPEncoder) Add(v LPPValue) *LPPEncoder {
+	t, ok := lppTypeByName(v.Type)
+	if !ok || e.err != nil {
+		return e.add(v.Channel, v.Type)
+	}
+	var values []float64
+	if len(t.fields) == 1 {
+		n, ok := v.Value.(float64)
+		if !ok {
+			e.err = lppValueError(v, "value", v.Value)
+			return e
+		}
+		values = []float64{n}
+	} else {
+		fields, ok := v.Value.(map[string]interface{})
+		if !ok {
+			e.err = fmt.Errorf("LPP %s on channel %d: value must be an object with %s", v.Type, v.Channel, lppFieldNames(t))
+			return e
+		}
+		for _, f := range t.fields {
+			n, ok := fields[f.name].(float64)
+			if !ok {
+				e.err = lppValueError(v, "field "+f.name, fields[f.name])
+				return e
+			}
+			values = append(values, n)
+		}
+	}
+	return e.add(v.Channel, v.Type, values...)
+}
+
+func lppValueError(v LPPValue, name string, value interface{}) error {
+	if value == nil {
+		return fmt.Errorf("LPP %s on channel %d: %s is missing", v.Type, v.Channel, name)
+	}
+	return fmt.Errorf("LPP %s on channel %d: %s is not a number", v.Type, v.Channel, name)
+}
+
+func lppFieldNames(t lppType) string {
+	names := make([]string, len(t.fields))
+	for i, f := range t.fields {
+		names[i] = f.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Bytes returns the payload, or the first error of the values added
+func (e *LPPEncoder) Bytes() ([]byte, error) {
+	return e.buf, e.err
+}
+
+// DecodeLPP returns the readings of a Cayenne LPP payload
+func DecodeLPP(payload []byte) ([]LPPValue, error) {
+	var values []LPPValue
+	for i := 0; i < len(payload); {
+		if i+2 > len(payload) {
+			return values, fmt.Errorf("LPP payload ends in the header at byte %d", i)
+		}
+		channel, id := payload[i], payload[i+1]
+		t, ok := lppTypeByID(id)
+		if !ok {
+			return values, fmt.Errorf("unknown LPP type %d at byte %d", id, i+1)
+		}
+		i += 2
+		fields := make(map[string]interface{})
+		for _, f := range t.fields {
+			if i+f.size > len(payload) {
+				return values, fmt.Errorf("LPP %s on channel %d is cut off", t.name, channel)
+			}
+			var v int64
+			for _, b := range payload[i : i+f.size] {
+				v = v<<8 | int64(b)
+			}
+			if bits := uint(f.size * 8); f.signed && v >= int64(1)<<(bits-1) {
+				v -= int64(1) << bits
+			}
+			fields[f.name] = float64(v) / f.scale
+			i += f.size
+		}
+		value := LPPValue{Channel: channel, Type: t.name, Value: fields}
+		if len(t.fields) == 1 {
+			value.Value = fields[""]
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// EncodeLPPJSON encodes a JSON array of readings as Cayenne LPP
+func EncodeLPPJSON(data []byte) ([]byte, error) {
+	var values []LPPValue
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	e := NewLPPEncoder()
+	for _, v := range values {
+		e.Add(v)
+	}
+	return e.Bytes()
+}
+
+// DecodeLPPJSON decodes a Cayenne LPP payload to a JSON array of readings
+func DecodeLPPJSON(payload []byte) ([]byte, error) {
+	values, err := DecodeLPP(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(values, "", "  ")
+}
@@ -0,0 +1,95 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLPPEncoder(t *testing.T) {
+	// the examples of the Cayenne LPP documentation
+	tests := []struct {
+		e    *LPPEncoder
+		want string
+	}{
+		{NewLPPEncoder().AddTemperature(3, 27.2).AddTemperature(5, 25.5), "036701100567 00ff"},
+		{NewLPPEncoder().AddAccelerometer(6, 1.234, -1.234, 0), "067104d2fb2e0000"},
+		{NewLPPEncoder().AddGPS(1, 42.3519, -87.9094, 10), "018806765ff2960a0003e8"},
+		{NewLPPEncoder().AddHumidity(2, 40).AddDigitalInput(4, 1).AddBarometer(7, 1013.2), "026850040001077327 94"},
+	}
+	for _, test := range tests {
+		got, err := test.e.Bytes()
+		want, _ := hex.DecodeString(strings.Replace(test.want, " ", "", -1))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("got %x, %v, want %x", got, err, want)
+		}
+	}
+	if _, err := NewLPPEncoder().AddTemperature(1, 4000).AddHumidity(2, 50).Bytes(); err == nil {
+		t.Error("temperature out of range accepted")
+	}
+}
+
+func TestLPPRoundTrip(t *testing.T) {
+	values := []LPPValue{
+		{Channel: 1, Type: "temperature", Value: -12.5},
+		{Channel: 2, Type: "humidity", Value: 63.5},
+		{Channel: 3, Type: "gps", Value: map[string]interface{}{"lat": 52.0907, "lon": 5.1214, "alt": -2.5}},
+		{Channel: 4, Type: "gyrometer", Value: map[string]interface{}{"x": 1.5, "y": -0.25, "z": 300.0}},
+		{Channel: 5, Type: "analog_input", Value: -3.3},
+	}
+	e := NewLPPEncoder()
+	for _, v := range values {
+		e.Add(v)
+	}
+	payload, err := e.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeLPP(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, values) {
+		t.Errorf("got %+v\nwant %+v", decoded, values)
+	}
+
+	json := `[{"channel":1,"type":"temperature","value":21.5},{"channel":2,"type":"gps","value":{"lat":52.09,"lon":5.12,"alt":3}}]`
+	payload, err = EncodeLPPJSON([]byte(json))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "016700d7028807f2c400c80000012c"; hex.EncodeToString(payload) != want {
+		t.Errorf("EncodeLPPJSON = %x, want %s", payload, want)
+	}
+}
+
+func TestLPPAddErrors(t *testing.T) {
+	tests := []struct {
+		json, err string
+	}{
+		{`[{"channel":1,"type":"gps","value":{"lon":5.12,"alt":3}}]`, "field lat is missing"},
+		{`[{"channel":1,"type":"gps","value":{"lat":"52.09","lon":5.12,"alt":3}}]`, "field lat is not a number"},
+		{`[{"channel":1,"type":"accelerometer","value":1}]`, "value must be an object with x, y, z"},
+		{`[{"channel":1,"type":"temperature"}]`, "value is missing"},
+		{`[{"channel":1,"type":"temperature","value":{"value":1}}]`, "value is not a number"},
+		{`[{"channel":1,"type":"smell","value":1}]`, "unknown LPP type smell"},
+		{`[{"channel":1,"type":"temperature","value":20},{"channel":2,"type":"humidity"}]`, "LPP humidity on channel 2"},
+	}
+	for _, test := range tests {
+		_, err := EncodeLPPJSON([]byte(test.json))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("EncodeLPPJSON(%s) error %v, want %q", test.json, err, test.err)
+		}
+	}
+}
+
+func TestDecodeLPPErrors(t *testing.T) {
+	for _, payload := range []string{"03", "03ff0110", "036701", "0388010203"} {
+		data, _ := hex.DecodeString(payload)
+		if _, err := DecodeLPP(data); err == nil {
+			t.Errorf("DecodeLPP(%s) accepted", payload)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package senbiotpkg
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttachRetries is how often each waitfornetwork request is polled, once a second
+var AttachRetries = 10
+
+// Modem hides the AT commands of a module behind a common interface
+type Modem interface {
+	// Identify returns the model and firmware of the module
+	Identify() (Identity, error)
+	// Attach runs the setupnetwork sequence and waits until the network is attached
+	Attach() error
+	// Send sends a message to the platform
+	Send(messagebyte []byte) error
+	// Receive waits for a message from the platform
+	Receive(timeout time.Duration) ([]byte, error)
+	// Status returns the signal and registration of the module
+	Status() (Status, error)
+	// Reboot restarts the module
+	Reboot() error
+	// Close closes the serial port
+	Close() error
+}
+
+// Status is the connection state of a module
+type Status struct {
+	RSSI         int
+	Registration Registration
+	Attached     bool
+}
+
+// Driver creates the Modem for a setup on an opened serial port
+type Driver func(port serial.Port, c Setup) Modem
+
+var (
+	driversMu sync.Mutex
+	drivers   = make(map[string]Driver)
+)
+
+// RegisterDriver makes a driver available for the setups with the given device name
+func RegisterDriver(device string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[device] = d
+}
+
+// NewModem returns the Modem of the driver registered for the device of the setup
+func NewModem(port serial.Port, c Setup) (Modem, error) {
+	driversMu.Lock()
+	d, ok := drivers[c.Setup]
+	driversMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no driver for device %s", c.Setup)
+	}
+	return d(port, c), nil
+}
+
+func init() {
+	RegisterDriver("ublox01b", newATModem)
+	RegisterDriver("ublox02b", newATModem)
+}
+
+// atModem drives a module with the sequences of its setup, as the u-blox SARA-N2 is
+type atModem struct {
+	port  serial.Port
+	setup Setup
+}
+
+func newATModem(port serial.Port, c Setup) Modem {
+	return &atModem{port: port, setup: c}
+}
+
+func (m *atModem) Identify() (Identity, error) {
+	return Identify(m.port)
+}
+
+func (m *atModem) Attach() error {
+	if err := RunSequence(m.port, m.setup.SetupNetwork); err != nil {
+		return err
+	}
+	for _, v := range m.setup.WaitForNetwork {
+		var attached bool
+		for i := 0; i < AttachRetries && !attached; i++ {
+			response, err := RunRequest(m.port, v)
+			if err != nil {
+				return err
+			}
+			attached = isAttached(strings.Join(response, "\n"), v)
+			if !attached {
+				time.Sleep(time.Second)
+			}
+		}
+		if !attached {
+			return fmt.Errorf("could not get connection: %s still answers %s", v.Request, v.NegativeResponse)
+		}
+	}
+	return nil
+}
+
+// isAttached checks a waitfornetwork answer against its negative and expected response
+func isAttached(result string, v RequestResponse) bool {
+	if len(v.NegativeResponse) != 0 && strings.Contains(result, v.NegativeResponse) {
+		return false
+	}
+	return len(v.WaitForResponse) == 0 || strings.Contains(result, v.WaitForResponse)
+}
+
+// SendRequest returns the command that sends messagebyte with the
+// sendmesssagestring of the setup. All setups give the length of the
+// message in bytes, not the length of its hex, as AT+NMGS, AT+QLWULDATA
+// and AT+NSOST expect.
+func SendRequest(c Setup, messagebyte []byte) string {
+	return fmt.Sprintf("%s%d,%s", c.SendMessageString, len(messagebyte), EncodeMessageByte(messagebyte))
+}
+
+func (m *atModem) Send(messagebyte []byte) error {
+	if err := CheckPayloadSize(m.setup, len(messagebyte)); err != nil {
+		return err
+	}
+	_, err := SendCommand(m.port, SendRequest(m.setup, messagebyte), DefaultTimeout)
+	return err
+}
+
+func (m *atModem) Receive(timeout time.Duration) ([]byte, error) {
+	return receive(m.port, timeout, "+NNMI", "+NSONMI")
+}
+
+// receive waits for a downlink result with one of the names and returns its
+// data, the data announced by +NSONMI is read from the socket
+func receive(port serial.Port, timeout time.Duration, names ...string) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		line, err := readLine(port, deadline)
+		if err != nil {
+			return nil, err
+		}
+		var known bool
+		for _, name := range names {
+			known = known || strings.HasPrefix(line, name+":")
+		}
+		if !known {
+			continue
+		}
+		u, err := ParseURC(line)
+		if err != nil {
+			return nil, err
+		}
+		if u.Data != nil {
+			return u.Data, nil
+		}
+		return readSocket(port, u.Socket, u.Length)
+	}
+}
+
+// readSocket reads data announced by +NSONMI with AT+NSORF, which answers
+// <socket>,<ip>,<port>,<length>,<data>,<remaining>
+func readSocket(port serial.Port, socket, length int) ([]byte, error) {
+	response, err := SendCommand(port, fmt.Sprintf("AT+NSORF=%d,%d", socket, length), DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range response {
+		params := splitParams(line)
+		if len(params) == 6 && params[0] == strconv.Itoa(socket) {
+			return hex.DecodeString(params[4])
+		}
+	}
+	return nil, errors.New("no socket data in response")
+}
+
+func (m *atModem) Status() (Status, error) {
+	return readStatus(m.port)
+}
+
+func readStatus(port serial.Port) (Status, error) {
+	var s Status
+	response, err := SendCommand(port, "AT+CSQ", DefaultTimeout)
+	if err != nil {
+		return s, err
+	}
+	if value, ok := responseValue(response, "+CSQ:"); ok {
+		s.RSSI, _ = strconv.Atoi(splitParams(value)[0])
+	}
+	response, err = SendCommand(port, "AT+CEREG?", DefaultTimeout)
+	if err != nil {
+		return s, err
+	}
+	if value, ok := responseValue(response, "+CEREG:"); ok {
+		if s.Registration, err = ParseCEREG(value, true); err != nil {
+			return s, err
+		}
+	}
+	response, err = SendCommand(port, "AT+CGATT?", DefaultTimeout)
+	if err != nil {
+		return s, err
+	}
+	value, _ := responseValue(response, "+CGATT:")
+	s.Attached = value == "1"
+	return s, nil
+}
+
+func (m *atModem) Reboot() error {
+	_, err := RebootDevice(m.port, m.setup, RebootTimeout)
+	return err
+}
+
+func (m *atModem) Close() error {
+	return m.port.Close()
+}
+
+// RunSequence runs the requests of a sequence of the setup
+func RunSequence(port serial.Port, sequence []RequestResponse) error {
+	for _, v := range sequence {
+		if _, err := RunRequest(port, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunRequest sends a request of a sequence and returns the lines of the
+// answer. The request succeeds on OK, or on its response when one is set.
+// Lines that arrived before the request are dropped.
+func RunRequest(port serial.Port, v RequestResponse) ([]string, error) {
+	drainLines(port)
+	if _, err := port.Write([]byte(fmt.Sprintf("%s\r\n", v.Request))); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(DefaultTimeout)
+	var response []string
+	for {
+		line, err := readLine(port, deadline)
+		if err != nil {
+			return response, err
+		}
+		switch {
+		case len(v.Response) != 0 && line == v.Response:
+			return response, nil
+		case line == "OK":
+			if len(v.Response) != 0 && v.Response != "OK" {
+				return response, fmt.Errorf("response to %s was OK, expected %s", v.Request, v.Response)
+			}
+			return response, nil
+		case line == "ERROR", strings.HasPrefix(line, "+CME ERROR"):
+			return response, &CommandError{Request: v.Request, Response: line}
+		case line == v.Request:
+			// echo of the command
+		default:
+			response = append(response, line)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ubloxSetup has the waitfornetwork sequence of the u-blox setups of config.yml
+var ubloxSetup = Setup{
+	Setup: "ublox02b",
+	SetupNetwork: []RequestResponse{
+		{Request: "AT+CFUN=1", Response: "OK"},
+	},
+	WaitForNetwork: []RequestResponse{
+		{Request: "AT+CGATT?", NegativeResponse: "+CGATT:0", WaitForResponse: "+CGATT:1"},
+	},
+	SendMessageString: "AT+NMGS=",
+}
+
+func TestSendRequest(t *testing.T) {
+	tests := []struct {
+		setup Setup
+		want  string
+	}{
+		{ubloxSetup, "AT+NMGS=5,48656c6c6f"},
+		{bc95Setup, "AT+NMGS=5,48656c6c6f"},
+		{bc66Setup, "AT+QLWULDATA=5,48656c6c6f"},
+		{udpSetup, `AT+NSOST=0,"10.0.0.1",5683,5,48656c6c6f`},
+	}
+	for _, test := range tests {
+		if got := SendRequest(test.setup, []byte("Hello")); got != test.want {
+			t.Errorf("SendRequest(%s) = %s, want %s", test.setup.SendMessageString, got, test.want)
+		}
+	}
+}
+
+func TestRunRequest(t *testing.T) {
+	answer := func(request string) []string {
+		switch request {
+		case "AT+NRB":
+			return []string{"AT+NRB", "REBOOTING", "OK"}
+		case "AT+CGATT?":
+			return []string{"AT+CGATT?", "+CGATT:1", "OK"}
+		case "AT+CFUN=0":
+			return []string{"+CME ERROR: 4"}
+		case "AT+NMGS=1,00":
+			return []string{"ERROR"}
+		}
+		return []string{"OK"}
+	}
+	tests := []struct {
+		v    RequestResponse
+		want []string
+		err  bool
+	}{
+		{RequestResponse{Request: "AT+CGATT?"}, []string{"+CGATT:1"}, false},
+		{RequestResponse{Request: "AT+CFUN=1", Response: "OK"}, nil, false},
+		{RequestResponse{Request: "AT+NRB", Response: "REBOOTING"}, nil, false},
+		{RequestResponse{Request: "AT+CFUN=1", Response: "REBOOTING"}, nil, true},
+		{RequestResponse{Request: "AT+CFUN=0"}, nil, true},
+		{RequestResponse{Request: "AT+NMGS=1,00"}, nil, true},
+	}
+	for _, test := range tests {
+		port := newFakePort(answer)
+		got, err := RunRequest(port, test.v)
+		if (err != nil) != test.err || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("RunRequest(%s) = %q, %v, want %q", test.v.Request, got, err, test.want)
+		}
+	}
+
+	port := newFakePort(answer)
+	_, err := RunRequest(port, RequestResponse{Request: "AT+CFUN=0"})
+	if e, ok := err.(*CommandError); !ok || e.Response != "+CME ERROR: 4" {
+		t.Errorf("RunRequest(AT+CFUN=0) = %v, want a CommandError", err)
+	}
+}
+
+func TestIsAttached(t *testing.T) {
+	csq := RequestResponse{Request: "AT+CSQ", NegativeResponse: "CSQ:99,99"}
+	cgatt := RequestResponse{Request: "AT+CGATT?", NegativeResponse: "CGATT:0", WaitForResponse: "CGATT:1"}
+	tests := []struct {
+		result string
+		v      RequestResponse
+		want   bool
+	}{
+		{"+CSQ:21,99", csq, true},
+		{"+CSQ:99,99", csq, false},
+		{"+CGATT:1", cgatt, true},
+		{"+CGATT:0", cgatt, false},
+		{"", cgatt, false},
+		{"", RequestResponse{Request: "AT"}, true},
+	}
+	for _, test := range tests {
+		if got := isAttached(test.result, test.v); got != test.want {
+			t.Errorf("isAttached(%q, %s) = %v, want %v", test.result, test.v.Request, got, test.want)
+		}
+	}
+}
+
+func TestATModemAttach(t *testing.T) {
+	saved := AttachRetries
+	defer func() { AttachRetries = saved }()
+	AttachRetries = 3
+
+	tests := []struct {
+		name  string
+		polls int
+		ok    bool
+	}{
+		{"attached", 0, true},
+		{"attached after polling", 1, true},
+		{"not attached", 3, false},
+	}
+	for _, test := range tests {
+		polls := test.polls
+		port := newFakePort(func(request string) []string {
+			if request == "AT+CGATT?" {
+				if polls > 0 {
+					polls--
+					return []string{"+CGATT:0", "OK"}
+				}
+				return []string{"+CGATT:1", "OK"}
+			}
+			return []string{"OK"}
+		})
+		modem, err := NewModem(port, ubloxSetup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := modem.Attach(); (err == nil) != test.ok {
+			t.Errorf("%s: Attach = %v", test.name, err)
+		}
+		if got := strings.Join(port.Requests(), " "); !strings.HasPrefix(got, "AT+CFUN=1 AT+CGATT?") {
+			t.Errorf("%s: requests %s", test.name, got)
+		}
+	}
+}
+
+func TestATModemReceive(t *testing.T) {
+	port := newFakePort(func(request string) []string {
+		if request == "AT+NSORF=1,5" {
+			return []string{`1,"10.0.0.1",5683,5,48656C6C6F,0`, "OK"}
+		}
+		return []string{"OK"}
+	})
+	modem, err := NewModem(port, ubloxSetup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		urcs string
+		want string
+	}{
+		{"+CEREG:1\r\n+NNMI:5,48656C6C6F\r\n", "Hello"},
+		{"+NSONMI:1,5\r\n", "Hello"},
+		// a downlink of the BC66 is not one of the u-blox
+		{"+QLWDATARECV: 19,1,0,2,4869\r\n+NNMI:2,4869\r\n", "Hi"},
+	}
+	for _, test := range tests {
+		for _, b := range []byte(test.urcs) {
+			port.out <- b
+		}
+		if data, err := modem.Receive(time.Second); err != nil || string(data) != test.want {
+			t.Errorf("Receive after %q = %q, %v, want %s", test.urcs, data, err, test.want)
+		}
+	}
+	if _, err := modem.Receive(10 * time.Millisecond); err != ErrTimeout {
+		t.Errorf("Receive without data = %v, want ErrTimeout", err)
+	}
+}
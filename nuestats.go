@@ -0,0 +1,127 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"strings"
+)
+
+// RadioStats are the radio values of the serving cell. Powers, RSRQ and SNR
+// are in tenths of a dB(m), as reported by the module.
+type RadioStats struct {
+	SignalPower int `json:"signal_power"`
+	TotalPower  int `json:"total_power"`
+	TXPower     int `json:"tx_power"`
+	TXTime      int `json:"tx_time"`
+	RXTime      int `json:"rx_time"`
+	CellID      int `json:"cell_id"`
+	ECL         int `json:"ecl"`
+	SNR         int `json:"snr"`
+	EARFCN      int `json:"earfcn"`
+	PCI         int `json:"pci"`
+	RSRQ        int `json:"rsrq"`
+}
+
+// set stores a value of NUESTATS and reports whether key is known and value a number
+func (r *RadioStats) set(key, value string) bool {
+	v, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	switch strings.ToUpper(strings.TrimSpace(key)) {
+	case "SIGNAL POWER":
+		r.SignalPower = v
+	case "TOTAL POWER":
+		r.TotalPower = v
+	case "TX POWER":
+		r.TXPower = v
+	case "TX TIME":
+		r.TXTime = v
+	case "RX TIME":
+		r.RXTime = v
+	case "CELL ID":
+		r.CellID = v
+	case "ECL":
+		r.ECL = v
+	case "SNR":
+		r.SNR = v
+	case "EARFCN":
+		r.EARFCN = v
+	case "PCI":
+		r.PCI = v
+	case "RSRQ":
+		r.RSRQ = v
+	default:
+		return false
+	}
+	return true
+}
+
+// ParseNUESTATS parses the lines of AT+NUESTATS. Both the u-blox format
+// "Signal power:-759" and the Quectel BC95 format
+// "NUESTATS:RADIO,Signal power,-759" are understood, as is the
+// "+QENG: 0,..." serving cell line of the Quectel BC66.
+func ParseNUESTATS(response []string) (RadioStats, error) {
+	var r RadioStats
+	var found bool
+	for _, line := range response {
+		switch {
+		case strings.HasPrefix(line, "NUESTATS:"):
+			params := strings.Split(strings.TrimPrefix(line, "NUESTATS:"), ",")
+			if len(params) == 3 && r.set(params[1], params[2]) {
+				found = true
+			}
+		case strings.HasPrefix(line, "+QENG:"):
+			if parseQENG(&r, strings.TrimPrefix(line, "+QENG:")) {
+				found = true
+			}
+		default:
+			if i := strings.Index(line, ":"); i > 0 && r.set(line[:i], line[i+1:]) {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return r, errors.New("no radio statistics in response")
+	}
+	return r, nil
+}
+
+// parseQENG parses the BC66 serving cell line
+// 0,<earfcn>,<earfcn_offset>,<pci>,<cellID>,<rsrp>,<rsrq>,<rssi>,<sinr>,<band>,<tac>,<ecl>,<tx_pwr>,<mode>
+func parseQENG(r *RadioStats, value string) bool {
+	params := splitParams(value)
+	if len(params) < 13 || params[0] != "0" {
+		return false
+	}
+	values := make([]int, len(params))
+	for i, p := range params {
+		values[i], _ = strconv.Atoi(p)
+	}
+	// the cell ID is hexadecimal, the powers, RSRQ and SINR are in whole dB(m)
+	cellID, _ := strconv.ParseInt(params[4], 16, 64)
+	r.EARFCN = values[1]
+	r.PCI = values[3]
+	r.CellID = int(cellID)
+	r.SignalPower = values[5] * 10
+	r.RSRQ = values[6] * 10
+	r.TotalPower = values[7] * 10
+	r.SNR = values[8] * 10
+	r.ECL = values[11]
+	r.TXPower = values[12] * 10
+	return true
+}
+
+// ReadRadioStats asks the module for the radio statistics of the serving cell
+func ReadRadioStats(port serial.Port, c Setup) (RadioStats, error) {
+	request := "AT+NUESTATS"
+	if len(c.RadioStatsRequest) != 0 {
+		request = c.RadioStatsRequest
+	}
+	response, err := SendCommand(port, request, DefaultTimeout)
+	if err != nil {
+		return RadioStats{}, err
+	}
+	return ParseNUESTATS(response)
+}
@@ -0,0 +1,81 @@
+package senbiotpkg
+
+import "testing"
+
+func TestParseNUESTATS(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []string
+		want     RadioStats
+		err      bool
+	}{
+		{"BC95", []string{
+			"Signal power:-907",
+			"Total power:-817",
+			"TX power:-32768",
+			"TX time:0",
+			"RX time:6998",
+			"Cell ID:38005378",
+			"ECL:0",
+			"SNR:-17",
+			"EARFCN:2506",
+			"PCI:58",
+			"RSRQ:-108",
+		}, RadioStats{SignalPower: -907, TotalPower: -817, TXPower: -32768, RXTime: 6998,
+			CellID: 38005378, SNR: -17, EARFCN: 2506, PCI: 58, RSRQ: -108}, false},
+		{"BC95-G", []string{
+			"NUESTATS:RADIO,Signal power,-682",
+			"NUESTATS:RADIO,Total power,-600",
+			"NUESTATS:RADIO,TX power,-100",
+			"NUESTATS:RADIO,TX time,1023",
+			"NUESTATS:RADIO,RX time,4521",
+			"NUESTATS:RADIO,Cell ID,24377601",
+			"NUESTATS:RADIO,ECL,1",
+			"NUESTATS:RADIO,SNR,131",
+			"NUESTATS:RADIO,EARFCN,6352",
+			"NUESTATS:RADIO,PCI,173",
+			"NUESTATS:RADIO,RSRQ,-114",
+			"NUESTATS:BLER,RLC UL BLER,3",
+		}, RadioStats{SignalPower: -682, TotalPower: -600, TXPower: -100, TXTime: 1023, RXTime: 4521,
+			CellID: 24377601, ECL: 1, SNR: 131, EARFCN: 6352, PCI: 173, RSRQ: -114}, false},
+		{"BC66", []string{
+			`+QENG: 0,6352,0,173,"173FA01",-84,-11,-73,9,20,"5E1F",1,-3,2`,
+		}, RadioStats{SignalPower: -840, TotalPower: -730, TXPower: -30, CellID: 0x173fa01,
+			ECL: 1, SNR: 90, EARFCN: 6352, PCI: 173, RSRQ: -110}, false},
+		{"BC66 neighbour cell only", []string{`+QENG: 1,6352,0,174,-90,-12,-80,4`}, RadioStats{}, true},
+		{"empty", nil, RadioStats{}, true},
+		{"other answers", []string{"+CSCON:0,1", "Version:B657SP3", "Signal power:unknown"}, RadioStats{}, true},
+		{"BC95-G other statistics", []string{"NUESTATS:BLER,RLC UL BLER,3", "NUESTATS:THP,RLC UL,1500"}, RadioStats{}, true},
+		{"known keys among others", []string{"+CSCON:0,1", "PCI:58"}, RadioStats{PCI: 58}, false},
+	}
+	for _, test := range tests {
+		got, err := ParseNUESTATS(test.response)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseQENG(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+		want  RadioStats
+	}{
+		{` 0,3734,2,104,"9D2F0B4",-77,-10,-67,15,8,"1A2D",0,,2`, true,
+			RadioStats{SignalPower: -770, TotalPower: -670, CellID: 0x9d2f0b4, SNR: 150, EARFCN: 3734, PCI: 104, RSRQ: -100}},
+		{` 0,3734,2,104`, false, RadioStats{}},
+		{` 1,3734,2,104,"9D2F0B4",-77,-10,-67,15,8,"1A2D",0,,2`, false, RadioStats{}},
+	}
+	for _, test := range tests {
+		var got RadioStats
+		ok := parseQENG(&got, test.value)
+		if ok != test.ok || got != test.want {
+			t.Errorf("parseQENG(%q) = %+v, %v, want %+v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
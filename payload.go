@@ -0,0 +1,112 @@
+package senbiotpkg
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// PayloadOptions are the steps PreparePayload takes on a message before it
+// is sent. A step is left out when its option is not set.
+type PayloadOptions struct {
+	// Envelope puts the message in an envelope with the next sequence
+	// number of SequenceFile, with the current time when Timestamp is set
+	// and with Type when HasType is set
+	Envelope     bool
+	SequenceFile string
+	Timestamp    bool
+	Type         uint8
+	HasType      bool
+	// Compress is the name of the compression, eg deflate or lz
+	Compress string
+	// KeyFile encrypts the message with the key of the device in the file,
+	// the message counter is kept in CounterFile, the key file with
+	// .counter by default
+	KeyFile     string
+	CounterFile string
+	// Fragment splits a message that is larger than the transport allows
+	// in fragments, else such a message is a *PayloadSizeError
+	Fragment bool
+	// Log, when not nil, is told about each step
+	Log io.Writer
+}
+
+func (o PayloadOptions) logf(format string, v ...interface{}) {
+	if o.Log != nil {
+		fmt.Fprintf(o.Log, format+"\n", v...)
+	}
+}
+
+// PreparePayload puts the message in an envelope, compresses it, encrypts
+// it and checks its size for the transport of setup c, as opts asks. It
+// returns the payloads to send: the message, or its fragments when it is
+// too large and opts.Fragment is set.
+func PreparePayload(c Setup, messagebyte []byte, opts PayloadOptions) ([][]byte, error) {
+	if opts.Envelope {
+		e, err := NewEnvelope(&Counter{File: opts.SequenceFile}, messagebyte)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Timestamp {
+			e.Time = time.Now()
+		}
+		e.Type, e.HasType = opts.Type, opts.HasType
+		opts.logf("Envelope with %v", e)
+		messagebyte = e.Bytes()
+	}
+	if len(opts.Compress) != 0 {
+		compression, err := CompressionByName(opts.Compress)
+		if err != nil {
+			return nil, err
+		}
+		if messagebyte, err = Compress(compression, messagebyte); err != nil {
+			return nil, err
+		}
+		opts.logf("Compressed to %d bytes", len(messagebyte))
+	}
+	if len(opts.KeyFile) != 0 {
+		keys, err := LoadKeys(opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		id, key, err := keys.Device()
+		if err != nil {
+			return nil, err
+		}
+		counter := &Counter{File: opts.CounterFile}
+		if len(counter.File) == 0 {
+			counter.File = opts.KeyFile + ".counter"
+		}
+		if messagebyte, err = SealPayload(id, key, counter, messagebyte); err != nil {
+			return nil, err
+		}
+		opts.logf("Encrypted for device %d", id)
+	}
+	err := CheckPayloadSize(c, len(messagebyte))
+	if err == nil {
+		return [][]byte{messagebyte}, nil
+	}
+	if !opts.Fragment {
+		return nil, err
+	}
+	return Fragments(c, messagebyte)
+}
+
+// UnwrapPayload takes the message out of a received, decrypted payload as
+// PreparePayload put it in: it decompresses the payload when decompress is
+// set and takes it out of its envelope when envelope is set. Without
+// envelope only the Payload of the returned Envelope is set. A payload is
+// not decompressed on its first byte alone, as an uncompressed payload may
+// start with a header byte of a compression as well.
+func UnwrapPayload(payload []byte, decompress, envelope bool) (Envelope, error) {
+	if decompress {
+		var err error
+		if payload, err = DecompressPayload(payload); err != nil {
+			return Envelope{}, err
+		}
+	}
+	if envelope {
+		return ParseEnvelope(payload)
+	}
+	return Envelope{Payload: payload}, nil
+}
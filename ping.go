@@ -0,0 +1,161 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PingTimeout is how long to wait for the +NPING result of a ping
+var PingTimeout = 15 * time.Second
+
+// PingResult is the answer to one ping
+type PingResult struct {
+	Seq     int
+	Address string
+	TTL     int
+	RTT     time.Duration
+	Err     error
+}
+
+// PingStats summarizes a series of pings like the ping tool does
+type PingStats struct {
+	Sent     int
+	Received int
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
+}
+
+// Loss returns the percentage of pings that got no answer
+func (s PingStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) * 100 / float64(s.Sent)
+}
+
+func (s PingStats) String() string {
+	return fmt.Sprintf("%d packets transmitted, %d received, %.1f%% packet loss\nrtt min/avg/max = %v/%v/%v",
+		s.Sent, s.Received, s.Loss(), s.Min, s.Avg, s.Max)
+}
+
+// PingAddress returns the address pinged in the networkinfo sequence of the
+// setup and whether the device wants it quoted
+func PingAddress(c Setup) (string, bool) {
+	for _, v := range c.NetworkInfo {
+		if strings.HasPrefix(v.Request, "AT+NPING=") {
+			address := strings.TrimSpace(strings.TrimPrefix(v.Request, "AT+NPING="))
+			return strings.Trim(address, "\""), strings.HasPrefix(address, "\"")
+		}
+	}
+	return "", false
+}
+
+// ParseNPING parses the +NPING:<address>,<ttl>,<rtt> and +NPINGERR:<err> results
+func ParseNPING(line string) (PingResult, error) {
+	var r PingResult
+	switch {
+	case strings.HasPrefix(line, "+NPINGERR:"):
+		code := strings.TrimSpace(strings.TrimPrefix(line, "+NPINGERR:"))
+		switch code {
+		case "1":
+			r.Err = errors.New("no response from remote host")
+		case "2":
+			r.Err = errors.New("failed to send ping")
+		default:
+			r.Err = fmt.Errorf("ping error %s", code)
+		}
+		return r, nil
+	case strings.HasPrefix(line, "+NPING:"):
+		params := splitParams(strings.TrimPrefix(line, "+NPING:"))
+		if len(params) != 3 {
+			return r, fmt.Errorf("invalid ping result %q", line)
+		}
+		r.Address = params[0]
+		ttl, err := strconv.Atoi(params[1])
+		if err != nil {
+			return r, fmt.Errorf("invalid ping result %q", line)
+		}
+		rtt, err := strconv.Atoi(params[2])
+		if err != nil {
+			return r, fmt.Errorf("invalid ping result %q", line)
+		}
+		r.TTL, r.RTT = ttl, time.Duration(rtt)*time.Millisecond
+		return r, nil
+	}
+	return r, fmt.Errorf("no ping result in %q", line)
+}
+
+// Ping sends one ping and waits for its result, a ping without answer is
+// returned with Err set. A result of an earlier ping that arrives late is
+// skipped: it is either from another address or reports a round trip time
+// longer than this ping has taken so far.
+func Ping(port serial.Port, address string, quoted bool) (PingResult, error) {
+	request := "AT+NPING=" + address
+	if quoted {
+		request = fmt.Sprintf("AT+NPING=\"%s\"", address)
+	}
+	sent := time.Now()
+	if _, err := SendCommand(port, request, DefaultTimeout); err != nil {
+		return PingResult{}, err
+	}
+	deadline := sent.Add(PingTimeout)
+	for {
+		line, err := readLine(port, deadline)
+		if err == ErrTimeout {
+			return PingResult{Address: address, Err: err}, nil
+		}
+		if err != nil {
+			return PingResult{}, err
+		}
+		if !strings.HasPrefix(line, "+NPING") {
+			continue
+		}
+		r, err := ParseNPING(line)
+		if err == nil && r.Err == nil && (r.Address != address || r.RTT > time.Since(sent)) {
+			continue
+		}
+		r.Address = address
+		return r, err
+	}
+}
+
+// PingSeries sends count pings, one every interval, calls report with each
+// result when it is not nil, and returns the statistics
+func PingSeries(port serial.Port, address string, quoted bool, count int, interval time.Duration, report func(PingResult)) (PingStats, error) {
+	var s PingStats
+	var total time.Duration
+	for seq := 1; seq <= count; seq++ {
+		start := time.Now()
+		r, err := Ping(port, address, quoted)
+		if err != nil {
+			return s, err
+		}
+		r.Seq = seq
+		s.Sent++
+		if r.Err == nil {
+			s.Received++
+			total += r.RTT
+			if s.Received == 1 || r.RTT < s.Min {
+				s.Min = r.RTT
+			}
+			if r.RTT > s.Max {
+				s.Max = r.RTT
+			}
+		}
+		if report != nil {
+			report(r)
+		}
+		if wait := interval - time.Since(start); seq < count && wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	if s.Received > 0 {
+		s.Avg = total / time.Duration(s.Received)
+	}
+	return s, nil
+}
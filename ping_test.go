@@ -0,0 +1,132 @@
+package senbiotpkg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNPING(t *testing.T) {
+	tests := []struct {
+		line string
+		want PingResult
+		err  string
+	}{
+		{"+NPING:10.0.0.1,55,230", PingResult{Address: "10.0.0.1", TTL: 55, RTT: 230 * time.Millisecond}, ""},
+		{`+NPING: "10.0.0.1",55,0`, PingResult{Address: "10.0.0.1", TTL: 55}, ""},
+		{"+NPINGERR:1", PingResult{}, "no response from remote host"},
+		{"+NPINGERR: 2", PingResult{}, "failed to send ping"},
+		{"+NPINGERR:7", PingResult{}, "ping error 7"},
+	}
+	for _, test := range tests {
+		got, err := ParseNPING(test.line)
+		if err != nil {
+			t.Errorf("ParseNPING(%q) error %v", test.line, err)
+			continue
+		}
+		if len(test.err) != 0 {
+			if got.Err == nil || got.Err.Error() != test.err {
+				t.Errorf("ParseNPING(%q) = %v, want %s", test.line, got.Err, test.err)
+			}
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseNPING(%q) = %+v, want %+v", test.line, got, test.want)
+		}
+	}
+	for _, line := range []string{"+NPING:10.0.0.1,55", "+NPING:10.0.0.1,x,230", "+NPING:10.0.0.1,55,y", "OK"} {
+		if _, err := ParseNPING(line); err == nil {
+			t.Errorf("ParseNPING(%q) succeeded", line)
+		}
+	}
+}
+
+// pingModule answers each AT+NPING with the next of answers, the lines
+// after the OK. It takes 5 ms to answer, so a round trip of up to 5 ms is
+// one of this ping.
+func pingModule(answers ...[]string) func(string) []string {
+	return func(request string) []string {
+		if !strings.HasPrefix(request, "AT+NPING=") || len(answers) == 0 {
+			return []string{"OK"}
+		}
+		time.Sleep(5 * time.Millisecond)
+		answer := answers[0]
+		answers = answers[1:]
+		return append([]string{"OK"}, answer...)
+	}
+}
+
+func TestPingSeries(t *testing.T) {
+	defer func(timeout time.Duration) { PingTimeout = timeout }(PingTimeout)
+	PingTimeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		answers [][]string
+		want    PingStats
+		results string
+	}{
+		{"all answered", [][]string{
+			{"+NPING:10.0.0.1,55,0"},
+			{"+NPING:10.0.0.1,55,0"},
+			{"+NPING:10.0.0.1,55,0"},
+		}, PingStats{Sent: 3, Received: 3}, "1:0s 2:0s 3:0s"},
+		{"loss", [][]string{
+			{"+NPINGERR:1"},
+			{"+NPING:10.0.0.1,55,0"},
+			nil,
+		}, PingStats{Sent: 3, Received: 1}, "1:no response from remote host 2:0s 3:timeout waiting for response"},
+		// the answer to the first ping arrives with the second
+		{"late answer", [][]string{
+			nil,
+			{"+NPING:10.0.0.1,55,900", "+NPING:10.0.0.1,55,0"},
+			{"+NPING:10.0.0.9,55,0", "+NPING:10.0.0.1,55,0"},
+		}, PingStats{Sent: 3, Received: 2}, "1:timeout waiting for response 2:0s 3:0s"},
+	}
+	for _, test := range tests {
+		port := newFakePort(pingModule(test.answers...))
+		var results []string
+		got, err := PingSeries(port, "10.0.0.1", false, 3, 0, func(r PingResult) {
+			if r.Err != nil {
+				results = append(results, fmt.Sprintf("%d:%v", r.Seq, r.Err))
+			} else {
+				results = append(results, fmt.Sprintf("%d:%v", r.Seq, r.RTT))
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s: PingSeries = %+v, want %+v", test.name, got, test.want)
+		}
+		if strings.Join(results, " ") != test.results {
+			t.Errorf("%s: results %q, want %q", test.name, strings.Join(results, " "), test.results)
+		}
+	}
+}
+
+func TestPingStats(t *testing.T) {
+	defer func(timeout time.Duration) { PingTimeout = timeout }(PingTimeout)
+	PingTimeout = 100 * time.Millisecond
+	port := newFakePort(pingModule(
+		[]string{"+NPING:10.0.0.1,55,0"},
+		[]string{"+NPING:10.0.0.1,55,3"},
+		[]string{"+NPINGERR:1"},
+		[]string{"+NPING:10.0.0.1,55,0"},
+	))
+	s, err := PingSeries(port, "10.0.0.1", false, 4, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PingStats{Sent: 4, Received: 3, Min: 0, Avg: time.Millisecond, Max: 3 * time.Millisecond}
+	if s != want {
+		t.Errorf("PingSeries = %+v, want %+v", s, want)
+	}
+	if s.Loss() != 25 {
+		t.Errorf("Loss = %v, want 25", s.Loss())
+	}
+	if (PingStats{}).Loss() != 0 {
+		t.Error("Loss without pings is not 0")
+	}
+}
@@ -0,0 +1,49 @@
+package senbiotpkg
+
+import (
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strings"
+)
+
+// AutoProvider as provider name picks the provider from the IMSI of the SIM
+const AutoProvider = "auto"
+
+// Provider couples a provider name to the PLMNs (MCC and MNC) of its SIMs
+type Provider struct {
+	Provider string   `yaml:"provider"`
+	PLMN     []string `yaml:"plmn"`
+}
+
+// ProviderForIMSI returns the provider with the longest PLMN that the IMSI starts with
+func ProviderForIMSI(providers []Provider, imsi string) (string, error) {
+	var chosen, plmn string
+	for _, p := range providers {
+		for _, v := range p.PLMN {
+			if strings.HasPrefix(imsi, v) && len(v) > len(plmn) {
+				chosen, plmn = p.Provider, v
+			}
+		}
+	}
+	if len(chosen) == 0 {
+		return "", fmt.Errorf("no provider configured for IMSI %s", imsi)
+	}
+	return chosen, nil
+}
+
+// DetectProvider reads the IMSI of the SIM and returns the matching provider
+// and the IMSI. The radio is switched on when the SIM can not be read.
+func DetectProvider(port serial.Port, c Setups) (string, string, error) {
+	imsi, err := ReadIMSI(port)
+	if _, ok := err.(*CommandError); ok {
+		if _, err = SendCommand(port, "AT+CFUN=1", DefaultTimeout); err != nil {
+			return "", "", err
+		}
+		imsi, err = ReadIMSI(port)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	provider, err := ProviderForIMSI(c.Providers, imsi)
+	return provider, imsi, err
+}
@@ -0,0 +1,72 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testProviders = []Provider{
+	{Provider: "t-mobilenl", PLMN: []string{"20416"}},
+	{Provider: "vodafone", PLMN: []string{"20404"}},
+	{Provider: "kpn", PLMN: []string{"2048", "20408"}},
+	{Provider: "kpn-iot", PLMN: []string{"204081"}},
+}
+
+func TestProviderForIMSI(t *testing.T) {
+	tests := []struct {
+		imsi string
+		want string
+		ok   bool
+	}{
+		{"204160123456789", "t-mobilenl", true},
+		{"204040123456789", "vodafone", true},
+		{"204080123456789", "kpn", true},
+		{"204081234567890", "kpn-iot", true},
+		{"204870123456789", "kpn", true},
+		{"262010123456789", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		got, err := ProviderForIMSI(testProviders, test.imsi)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("ProviderForIMSI(%q) = %q, %v, want %q", test.imsi, got, err, test.want)
+		}
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	c := Setups{Providers: testProviders}
+	tests := []struct {
+		name     string
+		radioOff bool
+		imsi     string
+		provider string
+		ok       bool
+		requests []string
+	}{
+		{"radio on", false, "204040123456789", "vodafone", true, []string{"AT+CIMI"}},
+		{"radio off", true, "204160123456789", "t-mobilenl", true, []string{"AT+CIMI", "AT+CFUN=1", "AT+CIMI"}},
+		{"unknown", false, "262010123456789", "", false, []string{"AT+CIMI"}},
+	}
+	for _, test := range tests {
+		radioOn := !test.radioOff
+		port := newFakePort(func(request string) []string {
+			switch {
+			case request == "AT+CFUN=1":
+				radioOn = true
+			case request == "AT+CIMI" && !radioOn:
+				return []string{"ERROR"}
+			case request == "AT+CIMI":
+				return []string{test.imsi, "OK"}
+			}
+			return []string{"OK"}
+		})
+		provider, imsi, err := DetectProvider(port, c)
+		if (err == nil) != test.ok || provider != test.provider || imsi != test.imsi {
+			t.Errorf("%s: DetectProvider = %q, %q, %v, want %q, %q", test.name, provider, imsi, err, test.provider, test.imsi)
+		}
+		if got := port.Requests(); !reflect.DeepEqual(got, test.requests) {
+			t.Errorf("%s: requests %q, want %q", test.name, got, test.requests)
+		}
+	}
+}
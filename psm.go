@@ -0,0 +1,320 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"time"
+)
+
+// TimerDeactivated is the duration of a 3GPP timer that is switched off
+const TimerDeactivated time.Duration = -1
+
+type timerUnit struct {
+	bits string
+	unit time.Duration
+}
+
+// T3412 (periodic TAU) units, GPRS Timer 3 in 3GPP TS 24.008
+var t3412Units = []timerUnit{
+	{"011", 2 * time.Second},
+	{"100", 30 * time.Second},
+	{"101", time.Minute},
+	{"000", 10 * time.Minute},
+	{"001", time.Hour},
+	{"010", 10 * time.Hour},
+	{"110", 320 * time.Hour},
+}
+
+// T3324 (active time) units, GPRS Timer 2 in 3GPP TS 24.008
+var t3324Units = []timerUnit{
+	{"000", 2 * time.Second},
+	{"001", time.Minute},
+	{"010", 6 * time.Minute},
+}
+
+// eDRX cycle lengths for NB-IoT, indexed by the 4 bit value
+var edrxCycles = map[string]time.Duration{
+	"0010": 20480 * time.Millisecond,
+	"0011": 40960 * time.Millisecond,
+	"0101": 81920 * time.Millisecond,
+	"1001": 163840 * time.Millisecond,
+	"1010": 327680 * time.Millisecond,
+	"1011": 655360 * time.Millisecond,
+	"1100": 1310720 * time.Millisecond,
+	"1101": 2621440 * time.Millisecond,
+	"1110": 5242880 * time.Millisecond,
+	"1111": 10485760 * time.Millisecond,
+}
+
+// PSMSettings are the power saving and eDRX timers of the device
+type PSMSettings struct {
+	PeriodicTAU time.Duration // T3412
+	ActiveTime  time.Duration // T3324
+	EDRXCycle   time.Duration
+	PagingTime  time.Duration
+}
+
+func (p PSMSettings) String() string {
+	return fmt.Sprintf("periodic TAU: %v, active time: %v, eDRX cycle: %v, paging time window: %v",
+		timerString(p.PeriodicTAU), timerString(p.ActiveTime), timerString(p.EDRXCycle), timerString(p.PagingTime))
+}
+
+func timerString(d time.Duration) string {
+	if d == TimerDeactivated {
+		return "deactivated"
+	}
+	return d.String()
+}
+
+func encodeTimer(d time.Duration, units []timerUnit) (string, error) {
+	if d == TimerDeactivated {
+		return "11100000", nil
+	}
+	if d < 0 {
+		return "", fmt.Errorf("negative timer value %v", d)
+	}
+	// prefer an exact value, else round up to the smallest unit that fits
+	for _, u := range units {
+		if d%u.unit == 0 && d/u.unit <= 31 {
+			return fmt.Sprintf("%s%05b", u.bits, d/u.unit), nil
+		}
+	}
+	for _, u := range units {
+		value := (d + u.unit - 1) / u.unit
+		if value <= 31 {
+			return fmt.Sprintf("%s%05b", u.bits, value), nil
+		}
+	}
+	return "", fmt.Errorf("timer value %v too large", d)
+}
+
+func decodeTimer(bits string, units []timerUnit) (time.Duration, error) {
+	if len(bits) != 8 {
+		return 0, fmt.Errorf("timer %q is not 8 bits", bits)
+	}
+	value, err := strconv.ParseUint(bits[3:], 2, 8)
+	if err != nil {
+		return 0, fmt.Errorf("timer %q: %v", bits, err)
+	}
+	if bits[:3] == "111" {
+		return TimerDeactivated, nil
+	}
+	for _, u := range units {
+		if u.bits == bits[:3] {
+			return time.Duration(value) * u.unit, nil
+		}
+	}
+	return 0, fmt.Errorf("timer %q has unknown unit", bits)
+}
+
+// EncodeT3412 returns the 8 bit string for a periodic TAU duration
+func EncodeT3412(d time.Duration) (string, error) {
+	return encodeTimer(d, t3412Units)
+}
+
+// DecodeT3412 returns the duration of a periodic TAU bit string
+func DecodeT3412(bits string) (time.Duration, error) {
+	return decodeTimer(bits, t3412Units)
+}
+
+// EncodeT3324 returns the 8 bit string for an active time duration
+func EncodeT3324(d time.Duration) (string, error) {
+	return encodeTimer(d, t3324Units)
+}
+
+// DecodeT3324 returns the duration of an active time bit string
+func DecodeT3324(bits string) (time.Duration, error) {
+	return decodeTimer(bits, t3324Units)
+}
+
+// EncodeEDRX returns the 4 bit string of the shortest NB-IoT eDRX cycle
+// that is at least d
+func EncodeEDRX(d time.Duration) (string, error) {
+	var bits string
+	for b, cycle := range edrxCycles {
+		if cycle >= d && (len(bits) == 0 || cycle < edrxCycles[bits]) {
+			bits = b
+		}
+	}
+	if len(bits) == 0 {
+		return "", fmt.Errorf("eDRX cycle %v too large", d)
+	}
+	return bits, nil
+}
+
+// DecodeEDRX returns the NB-IoT eDRX cycle of a 4 bit string
+func DecodeEDRX(bits string) (time.Duration, error) {
+	cycle, ok := edrxCycles[bits]
+	if !ok {
+		return 0, fmt.Errorf("unknown eDRX value %q", bits)
+	}
+	return cycle, nil
+}
+
+// DecodePagingTime returns the NB-IoT paging time window of a 4 bit string
+func DecodePagingTime(bits string) (time.Duration, error) {
+	value, err := strconv.ParseUint(bits, 2, 8)
+	if err != nil || len(bits) != 4 {
+		return 0, fmt.Errorf("unknown paging time window %q", bits)
+	}
+	return time.Duration(value+1) * 2560 * time.Millisecond, nil
+}
+
+// SetupPSM requests power saving mode with the given periodic TAU and active time
+func SetupPSM(port serial.Port, tau, active time.Duration) error {
+	t3412, err := EncodeT3412(tau)
+	if err != nil {
+		return err
+	}
+	t3324, err := EncodeT3324(active)
+	if err != nil {
+		return err
+	}
+	_, err = SendCommand(port, fmt.Sprintf("AT+CPSMS=1,,,\"%s\",\"%s\"", t3412, t3324), DefaultTimeout)
+	return err
+}
+
+// DisablePSM switches power saving mode off
+func DisablePSM(port serial.Port) error {
+	_, err := SendCommand(port, "AT+CPSMS=0", DefaultTimeout)
+	return err
+}
+
+// SetupEDRX requests the shortest eDRX cycle that is at least cycle
+func SetupEDRX(port serial.Port, cycle time.Duration) error {
+	bits, err := EncodeEDRX(cycle)
+	if err != nil {
+		return err
+	}
+	_, err = SendCommand(port, fmt.Sprintf("AT+CEDRXS=1,5,\"%s\"", bits), DefaultTimeout)
+	return err
+}
+
+// ReadPSM returns the timers the network has granted, taken from the
+// +CEREG: 4 registration status and the eDRX read dynamic parameters.
+// The <n> setting of +CEREG is put back afterwards.
+func ReadPSM(port serial.Port) (PSMSettings, error) {
+	var p PSMSettings
+	err := withCEREGMode(port, 4, func(response []string) error {
+		value, ok := responseValue(response, "+CEREG:")
+		if !ok {
+			return errors.New("no +CEREG in response")
+		}
+		reg, err := ParseCEREG(value, true)
+		if err != nil {
+			return err
+		}
+		p.PeriodicTAU, p.ActiveTime = reg.PeriodicTAU, reg.ActiveTime
+		return nil
+	})
+	if err != nil {
+		return p, err
+	}
+
+	response, err := SendCommand(port, "AT+CEDRXRDP", DefaultTimeout)
+	if err != nil {
+		return p, err
+	}
+	if value, ok := responseValue(response, "+CEDRXRDP:"); ok {
+		params := splitParams(value)
+		// <AcT-type>,<Requested_eDRX>,<NW-provided_eDRX>,<Paging_time_window>
+		if len(params) >= 4 {
+			if p.EDRXCycle, err = DecodeEDRX(params[2]); err != nil {
+				return p, err
+			}
+			if p.PagingTime, err = DecodePagingTime(params[3]); err != nil {
+				return p, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// ReadCEREGMode returns the <n> setting of the +CEREG unsolicited result
+func ReadCEREGMode(port serial.Port) (int, error) {
+	response, err := SendCommand(port, "AT+CEREG?", DefaultTimeout)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := responseValue(response, "+CEREG:")
+	if !ok {
+		return 0, errors.New("no +CEREG in response")
+	}
+	n, err := strconv.Atoi(splitParams(value)[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid +CEREG %q", value)
+	}
+	return n, nil
+}
+
+// withCEREGMode sets +CEREG to mode n, hands the answer to AT+CEREG? to
+// read and restores the previous mode, also when read fails.
+func withCEREGMode(port serial.Port, n int, read func(response []string) error) error {
+	previous, err := ReadCEREGMode(port)
+	if err != nil {
+		return err
+	}
+	if previous != n {
+		if _, err := SendCommand(port, fmt.Sprintf("AT+CEREG=%d", n), DefaultTimeout); err != nil {
+			return err
+		}
+	}
+	response, err := SendCommand(port, "AT+CEREG?", DefaultTimeout)
+	if err == nil {
+		err = read(response)
+	}
+	if previous != n {
+		if _, restoreErr := SendCommand(port, fmt.Sprintf("AT+CEREG=%d", previous), DefaultTimeout); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}
+	return err
+}
+
+// Registration is the network registration status from +CEREG
+type Registration struct {
+	Stat        int
+	TAC         string
+	CellID      string
+	AcT         int
+	ActiveTime  time.Duration
+	PeriodicTAU time.Duration
+}
+
+// ParseCEREG parses the value of a +CEREG line. withMode is true for the
+// answer to AT+CEREG?, which starts with the <n> setting, and false for the
+// unsolicited result.
+func ParseCEREG(value string, withMode bool) (Registration, error) {
+	var r Registration
+	params := splitParams(value)
+	if withMode {
+		params = params[1:]
+	}
+	if len(params) == 0 || len(params[0]) == 0 {
+		return r, fmt.Errorf("invalid +CEREG %q", value)
+	}
+	var err error
+	if r.Stat, err = strconv.Atoi(params[0]); err != nil {
+		return r, fmt.Errorf("invalid +CEREG %q", value)
+	}
+	// <stat>,<tac>,<ci>,<AcT>,<cause_type>,<reject_cause>,<Active-Time>,<Periodic-TAU>
+	if len(params) > 2 {
+		r.TAC, r.CellID = params[1], params[2]
+	}
+	if len(params) > 3 && len(params[3]) > 0 {
+		r.AcT, _ = strconv.Atoi(params[3])
+	}
+	if len(params) > 6 && len(params[6]) > 0 {
+		if r.ActiveTime, err = DecodeT3324(params[6]); err != nil {
+			return r, err
+		}
+	}
+	if len(params) > 7 && len(params[7]) > 0 {
+		if r.PeriodicTAU, err = DecodeT3412(params[7]); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
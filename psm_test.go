@@ -0,0 +1,130 @@
+package senbiotpkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncodeT3412(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+		err  bool
+	}{
+		{10 * time.Second, "01100101", false},
+		{time.Hour, "00000110", false},
+		{24 * time.Hour, "00111000", false},
+		{70 * time.Second, "10000011", false},
+		{TimerDeactivated, "11100000", false},
+		{-5 * time.Second, "", true},
+		{320 * 32 * time.Hour, "", true},
+	}
+	for _, test := range tests {
+		got, err := EncodeT3412(test.in)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("EncodeT3412(%v) = %q, %v, want %q", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestDecodeT3324(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{"00000101", 10 * time.Second, false},
+		{"00100001", time.Minute, false},
+		{"01000011", 18 * time.Minute, false},
+		{"11100000", TimerDeactivated, false},
+		{"01100001", 0, true},
+		{"0001", 0, true},
+		{"0010000x", 0, true},
+	}
+	for _, test := range tests {
+		got, err := DecodeT3324(test.in)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("DecodeT3324(%q) = %v, %v, want %v", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestTimerRoundTrip(t *testing.T) {
+	for _, d := range []time.Duration{2 * time.Second, 62 * time.Second, 5 * time.Minute, 31 * time.Minute} {
+		bits, err := EncodeT3324(d)
+		if err != nil {
+			t.Fatalf("EncodeT3324(%v): %v", d, err)
+		}
+		got, err := DecodeT3324(bits)
+		if err != nil || got != d {
+			t.Errorf("DecodeT3324(EncodeT3324(%v)) = %v, %v", d, got, err)
+		}
+	}
+}
+
+func TestDecodeEDRX(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{"0010", 20480 * time.Millisecond, false},
+		{"0101", 81920 * time.Millisecond, false},
+		{"1111", 10485760 * time.Millisecond, false},
+		{"0000", 0, true},
+		{"101", 0, true},
+	}
+	for _, test := range tests {
+		got, err := DecodeEDRX(test.in)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("DecodeEDRX(%q) = %v, %v, want %v", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestEncodeEDRX(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+		err  bool
+	}{
+		{time.Second, "0010", false},
+		{30 * time.Second, "0011", false},
+		{81920 * time.Millisecond, "0101", false},
+		{3 * time.Hour, "", true},
+	}
+	for _, test := range tests {
+		got, err := EncodeEDRX(test.in)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("EncodeEDRX(%v) = %q, %v, want %q", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestParseCEREG(t *testing.T) {
+	tests := []struct {
+		value    string
+		withMode bool
+		want     Registration
+		err      bool
+	}{
+		{`4,1,"4E20","0A2B3C4D",9,,,"00000101","00100110"`, true,
+			Registration{Stat: 1, TAC: "4E20", CellID: "0A2B3C4D", AcT: 9, ActiveTime: 10 * time.Second, PeriodicTAU: 6 * time.Hour}, false},
+		{`5,"4E20","0A2B3C4D",9`, false, Registration{Stat: 5, TAC: "4E20", CellID: "0A2B3C4D", AcT: 9}, false},
+		{`0,2`, true, Registration{Stat: 2}, false},
+		{`2`, false, Registration{Stat: 2}, false},
+		{`2`, true, Registration{}, true},
+		{`x`, false, Registration{}, true},
+		{`4,1,"4E20","0A2B3C4D",9,,,"0000010","00100110"`, true, Registration{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseCEREG(test.value, test.withMode)
+		if (err != nil) != test.err {
+			t.Errorf("ParseCEREG(%q, %v) error %v", test.value, test.withMode, err)
+			continue
+		}
+		if !test.err && got != test.want {
+			t.Errorf("ParseCEREG(%q, %v) = %+v, want %+v", test.value, test.withMode, got, test.want)
+		}
+	}
+}
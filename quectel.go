@@ -0,0 +1,138 @@
+package senbiotpkg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterDriver("quicktel", newQuectelModem)
+	RegisterDriver("quicktelbc66", newQuectelModem)
+}
+
+// quectelModem drives the Quectel BC95-G and BC66, which differ from the
+// u-blox modules in how messages are sent
+type quectelModem struct {
+	atModem
+}
+
+func newQuectelModem(port serial.Port, c Setup) Modem {
+	return &quectelModem{atModem{port: port, setup: c}}
+}
+
+func (m *quectelModem) Send(messagebyte []byte) error {
+	return QuectelSend(m.port, m.setup, messagebyte)
+}
+
+// Receive also returns the LwM2M downlinks of the BC66
+func (m *quectelModem) Receive(timeout time.Duration) ([]byte, error) {
+	return receive(m.port, timeout, "+NNMI", "+NSONMI", "+QLWDATARECV")
+}
+
+// RegisterTimeout is how long the Quectel BC66 may take to register at the LwM2M server
+var RegisterTimeout = 60 * time.Second
+
+// URC is an unsolicited result about received data or a LwM2M event
+type URC struct {
+	Name   string
+	Socket int
+	Length int
+	Data   []byte
+	Event  int
+}
+
+// ParseURC parses the downlink and event results of u-blox and Quectel modules:
+//
+//	+NNMI:<length>,<data>
+//	+NSONMI:<socket>,<length>
+//	+NSONMI:<socket>,<ip>,<port>,<length>,<data>
+//	+QLWEVTIND:<type>
+//	+QLWDATARECV:<object>,<instance>,<resource>,<length>,<data>
+func ParseURC(line string) (URC, error) {
+	var u URC
+	i := strings.Index(line, ":")
+	if !strings.HasPrefix(line, "+") || i < 0 {
+		return u, fmt.Errorf("no result code in %q", line)
+	}
+	u.Name = line[:i]
+	params := splitParams(line[i+1:])
+	var err error
+	switch {
+	case u.Name == "+NNMI" && len(params) == 2:
+		if u.Length, err = strconv.Atoi(params[0]); err == nil {
+			u.Data, err = hex.DecodeString(params[1])
+		}
+	case u.Name == "+NSONMI" && len(params) == 2:
+		if u.Socket, err = strconv.Atoi(params[0]); err == nil {
+			u.Length, err = strconv.Atoi(params[1])
+		}
+	case u.Name == "+NSONMI" && len(params) == 5:
+		if u.Socket, err = strconv.Atoi(params[0]); err == nil {
+			if u.Length, err = strconv.Atoi(params[3]); err == nil {
+				u.Data, err = hex.DecodeString(params[4])
+			}
+		}
+	case u.Name == "+QLWDATARECV" && len(params) == 5:
+		if u.Length, err = strconv.Atoi(params[3]); err == nil {
+			u.Data, err = hex.DecodeString(params[4])
+		}
+	case u.Name == "+QLWEVTIND" && len(params) == 1:
+		u.Event, err = strconv.Atoi(params[0])
+	default:
+		return u, fmt.Errorf("unknown result %q", line)
+	}
+	if err != nil {
+		return u, fmt.Errorf("invalid result %q: %v", line, err)
+	}
+	if u.Data != nil && len(u.Data) != u.Length {
+		return u, fmt.Errorf("result %q has %d bytes, expected %d", line, len(u.Data), u.Length)
+	}
+	return u, nil
+}
+
+// QuectelRegister registers the BC66 at the LwM2M server and waits until
+// the server observes the data object, after which data can be sent
+func QuectelRegister(port serial.Port) error {
+	if _, err := SendCommand(port, "AT+QLWSREGIND=0", DefaultTimeout); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(RegisterTimeout)
+	for {
+		line, err := WaitForURC(port, "+QLWEVTIND", time.Until(deadline))
+		if err != nil {
+			return err
+		}
+		u, err := ParseURC(line)
+		if err != nil {
+			return err
+		}
+		switch u.Event {
+		case 1:
+			return fmt.Errorf("deregistered from LwM2M server")
+		case 3:
+			return nil
+		}
+	}
+}
+
+// QuectelSend sends a message with the sendmesssagestring of the setup,
+// AT+NMGS= on the BC95 and AT+QLWULDATA= on the BC66, see SendRequest. The
+// BC66 is registered when it refuses the data.
+func QuectelSend(port serial.Port, c Setup, messagebyte []byte) error {
+	if err := CheckPayloadSize(c, len(messagebyte)); err != nil {
+		return err
+	}
+	request := SendRequest(c, messagebyte)
+	_, err := SendCommand(port, request, DefaultTimeout)
+	if _, ok := err.(*CommandError); ok && strings.HasPrefix(c.SendMessageString, "AT+QLWULDATA") {
+		if err = QuectelRegister(port); err != nil {
+			return err
+		}
+		_, err = SendCommand(port, request, DefaultTimeout)
+	}
+	return err
+}
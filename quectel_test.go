@@ -0,0 +1,224 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseURC(t *testing.T) {
+	tests := []struct {
+		line string
+		want URC
+		err  bool
+	}{
+		{"+NNMI:2,1234", URC{Name: "+NNMI", Length: 2, Data: []byte{0x12, 0x34}}, false},
+		{"+NSONMI:0,4", URC{Name: "+NSONMI", Length: 4}, false},
+		{`+NSONMI:1,"10.0.0.1",5683,2,ABCD`, URC{Name: "+NSONMI", Socket: 1, Length: 2, Data: []byte{0xab, 0xcd}}, false},
+		{"+QLWEVTIND:3", URC{Name: "+QLWEVTIND", Event: 3}, false},
+		{"+QLWEVTIND: 1", URC{Name: "+QLWEVTIND", Event: 1}, false},
+		{"+QLWDATARECV: 19,1,0,2,1234", URC{Name: "+QLWDATARECV", Length: 2, Data: []byte{0x12, 0x34}}, false},
+		{"+QLWDATARECV: 19,1,0,3,1234", URC{}, true},
+		{"+NNMI:3,1234", URC{}, true},
+		{"+NNMI:2,12G4", URC{}, true},
+		{"+NSONMI:x,4", URC{}, true},
+		{"+CEREG:1", URC{}, true},
+		{"OK", URC{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseURC(test.line)
+		if (err != nil) != test.err {
+			t.Errorf("ParseURC(%q) error %v", test.line, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if got.Name != test.want.Name || got.Socket != test.want.Socket || got.Length != test.want.Length ||
+			got.Event != test.want.Event || !bytes.Equal(got.Data, test.want.Data) {
+			t.Errorf("ParseURC(%q) = %+v, want %+v", test.line, got, test.want)
+		}
+	}
+}
+
+// quectelModule simulates the Quectel BC95-G and BC66 as far as the setups
+// use them: the radio, network search and attach, and the uplink data
+type quectelModule struct {
+	// space is put after the colon of the results, as the BC66 does
+	space      string
+	radio      bool
+	registered bool
+	// polls is how often CGATT? answers 0 after COPS
+	polls int
+	// lwm2m is set once the BC66 is registered at the LwM2M server
+	lwm2m bool
+	// event is the +QLWEVTIND after registering, 3 is observed
+	event string
+	sent  []string
+}
+
+func (m *quectelModule) result(name, value string) string {
+	return name + ":" + m.space + value
+}
+
+func (m *quectelModule) answer(request string) []string {
+	switch {
+	case request == "AT+CFUN=1":
+		m.radio = true
+	case request == "AT+CFUN=0":
+		m.radio, m.registered = false, false
+	case strings.HasPrefix(request, "AT+NBAND="), strings.HasPrefix(request, "AT+QBAND="):
+		if m.radio {
+			return []string{"ERROR"}
+		}
+	case strings.HasPrefix(request, "AT+COPS=1,2,"):
+		if !m.radio {
+			return []string{"ERROR"}
+		}
+		m.registered = true
+	case request == "AT+CSQ":
+		if !m.registered {
+			return []string{m.result("+CSQ", "99,99"), "OK"}
+		}
+		return []string{m.result("+CSQ", "21,99"), "OK"}
+	case request == "AT+CGATT?":
+		if !m.registered {
+			return []string{m.result("+CGATT", "0"), "OK"}
+		}
+		if m.polls > 0 {
+			m.polls--
+			return []string{m.result("+CGATT", "0"), "OK"}
+		}
+		return []string{m.result("+CGATT", "1"), "OK"}
+	case strings.HasPrefix(request, "AT+NMGS="):
+		if !m.registered {
+			return []string{"ERROR"}
+		}
+		m.sent = append(m.sent, strings.TrimPrefix(request, "AT+NMGS="))
+	case request == "AT+QLWSREGIND=0":
+		m.lwm2m = m.event == "3"
+		return []string{"OK", "+QLWEVTIND: 0", "+QLWEVTIND: " + m.event}
+	case strings.HasPrefix(request, "AT+QLWULDATA="):
+		if !m.lwm2m {
+			return []string{"ERROR"}
+		}
+		m.sent = append(m.sent, strings.TrimPrefix(request, "AT+QLWULDATA="))
+	}
+	return []string{"OK"}
+}
+
+// the setupnetwork and waitfornetwork sequences of config.yml
+var (
+	bc95Setup = Setup{
+		Setup: "quicktel",
+		SetupNetwork: []RequestResponse{
+			{Request: "AT+CFUN=0", Response: "OK"},
+			{Request: "AT+NBAND=8", Response: "OK"},
+			{Request: "AT+CFUN=1", Response: "OK"},
+			{Request: `AT+COPS=1,2,"20416"`, Response: "OK"},
+		},
+		WaitForNetwork: []RequestResponse{
+			{Request: "AT+CSQ", NegativeResponse: "CSQ:99,99"},
+			{Request: "AT+CGATT?", NegativeResponse: "CGATT:0", WaitForResponse: "CGATT:1"},
+		},
+		SendMessageString: "AT+NMGS=",
+	}
+	bc66Setup = Setup{
+		Setup: "quicktelbc66",
+		SetupNetwork: []RequestResponse{
+			{Request: "AT+CFUN=0", Response: "OK"},
+			{Request: "AT+QBAND=1,8", Response: "OK"},
+			{Request: "AT+CFUN=1", Response: "OK"},
+			{Request: `AT+COPS=1,2,"20416"`, Response: "OK"},
+		},
+		WaitForNetwork: []RequestResponse{
+			{Request: "AT+CSQ", NegativeResponse: "CSQ: 99,99"},
+			{Request: "AT+CGATT?", NegativeResponse: "CGATT: 0", WaitForResponse: "CGATT: 1"},
+		},
+		SendMessageString: "AT+QLWULDATA=",
+	}
+)
+
+func TestQuectelAttach(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  Setup
+		module *quectelModule
+		ok     bool
+	}{
+		{"BC95", bc95Setup, &quectelModule{polls: 1}, true},
+		{"BC66", bc66Setup, &quectelModule{space: " "}, true},
+		// the band can only be set with the radio off
+		{"BC95 band refused", Setup{Setup: "quicktel", SetupNetwork: []RequestResponse{
+			{Request: "AT+CFUN=1", Response: "OK"},
+			{Request: "AT+NBAND=8", Response: "OK"},
+		}}, &quectelModule{}, false},
+	}
+	for _, test := range tests {
+		port := newFakePort(test.module.answer)
+		modem, err := NewModem(port, test.setup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := modem.Attach(); (err == nil) != test.ok {
+			t.Errorf("%s: Attach = %v", test.name, err)
+		}
+		if test.ok && (!test.module.registered || test.module.polls != 0) {
+			t.Errorf("%s: attached without registering or without polling until CGATT 1", test.name)
+		}
+	}
+}
+
+func TestQuectelSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    Setup
+		module   *quectelModule
+		ok       bool
+		requests []string
+	}{
+		{"BC95", bc95Setup, &quectelModule{registered: true}, true,
+			[]string{"AT+NMGS=5,48656c6c6f"}},
+		{"BC95 not registered", bc95Setup, &quectelModule{}, false,
+			[]string{"AT+NMGS=5,48656c6c6f"}},
+		{"BC66 registered", bc66Setup, &quectelModule{lwm2m: true}, true,
+			[]string{"AT+QLWULDATA=5,48656c6c6f"}},
+		{"BC66 registers and retries", bc66Setup, &quectelModule{event: "3"}, true,
+			[]string{"AT+QLWULDATA=5,48656c6c6f", "AT+QLWSREGIND=0", "AT+QLWULDATA=5,48656c6c6f"}},
+		{"BC66 deregistered", bc66Setup, &quectelModule{event: "1"}, false,
+			[]string{"AT+QLWULDATA=5,48656c6c6f", "AT+QLWSREGIND=0"}},
+	}
+	for _, test := range tests {
+		port := newFakePort(test.module.answer)
+		err := QuectelSend(port, test.setup, []byte("Hello"))
+		if (err == nil) != test.ok {
+			t.Errorf("%s: QuectelSend = %v", test.name, err)
+		}
+		if got := port.Requests(); !reflect.DeepEqual(got, test.requests) {
+			t.Errorf("%s: requests %q, want %q", test.name, got, test.requests)
+		}
+		if test.ok && !reflect.DeepEqual(test.module.sent, []string{"5,48656c6c6f"}) {
+			t.Errorf("%s: module received %q", test.name, test.module.sent)
+		}
+	}
+
+	if err := QuectelSend(newFakePort((&quectelModule{}).answer), bc66Setup, make([]byte, 513)); err == nil {
+		t.Error("QuectelSend of 513 bytes over CDP succeeded")
+	}
+}
+
+func TestQuectelReceive(t *testing.T) {
+	port := newFakePort(simModule)
+	modem, err := NewModem(port, bc66Setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []byte("+QLWEVTIND: 3\r\n+QLWDATARECV: 19,1,0,5,48656C6C6F\r\n") {
+		port.out <- b
+	}
+	if data, err := modem.Receive(time.Second); err != nil || string(data) != "Hello" {
+		t.Errorf("Receive = %q, %v, want Hello", data, err)
+	}
+}
@@ -0,0 +1,212 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScanTimeout is how long an operator scan with AT+COPS=? may take
+var ScanTimeout = 3 * time.Minute
+
+// Operator is a network found by an operator scan
+type Operator struct {
+	Status  int    `json:"status"`
+	Long    string `json:"long"`
+	Short   string `json:"short"`
+	Numeric string `json:"plmn"`
+	AcT     int    `json:"act"`
+}
+
+var operatorStatus = []string{"unknown", "available", "current", "forbidden"}
+
+// StatusName returns the status as text, eg available or forbidden
+func (o Operator) StatusName() string {
+	if o.Status >= 0 && o.Status < len(operatorStatus) {
+		return operatorStatus[o.Status]
+	}
+	return strconv.Itoa(o.Status)
+}
+
+// BandMeasurement is the signal found on a band during a band scan
+type BandMeasurement struct {
+	Band  int        `json:"band"`
+	RSSI  int        `json:"rssi"`
+	Stats RadioStats `json:"stats"`
+	Error string     `json:"error,omitempty"`
+}
+
+// ParseCOPS parses the operator list of AT+COPS=?, eg
+// (2,"Vodafone NL","VF NL","20404",9),(1,"T-Mobile NL","TMO NL","20416",9),,(0-4),(0-2)
+// The list ends at the first field that is not an operator group, the
+// supported modes and formats follow it after an empty field.
+func ParseCOPS(value string) ([]Operator, error) {
+	var operators []Operator
+	value = strings.TrimSpace(value)
+	for strings.HasPrefix(value, "(") {
+		end := groupEnd(value)
+		if end < 0 {
+			return operators, fmt.Errorf("unterminated operator %q", value)
+		}
+		group := value[1:end]
+		value = value[end+1:]
+		params := splitParams(group)
+		if len(params) < 4 {
+			break
+		}
+		var o Operator
+		var err error
+		if o.Status, err = strconv.Atoi(params[0]); err != nil {
+			return operators, fmt.Errorf("invalid operator %q", group)
+		}
+		o.Long, o.Short, o.Numeric = params[1], params[2], params[3]
+		if len(params) > 4 {
+			o.AcT, _ = strconv.Atoi(params[4])
+		}
+		operators = append(operators, o)
+		if !strings.HasPrefix(value, ",(") {
+			break
+		}
+		value = value[1:]
+	}
+	return operators, nil
+}
+
+// groupEnd returns the index of the ) that closes the group value starts
+// with, a ) within quotes does not count
+func groupEnd(value string) int {
+	quoted := false
+	for i, r := range value {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ')' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// ScanOperators lists the operators the module can see
+func ScanOperators(port serial.Port) ([]Operator, error) {
+	response, err := SendCommand(port, "AT+COPS=?", ScanTimeout)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := responseValue(response, "+COPS:")
+	if !ok {
+		return nil, errors.New("no +COPS in response")
+	}
+	return ParseCOPS(value)
+}
+
+// parseBands parses a band list like 8,20 or (1,3,5,8,20,28)
+func parseBands(value string) []int {
+	var bands []int
+	for _, p := range splitParams(strings.Trim(value, "()")) {
+		if band, err := strconv.Atoi(p); err == nil {
+			bands = append(bands, band)
+		}
+	}
+	return bands
+}
+
+func bandList(bands []int) string {
+	s := make([]string, len(bands))
+	for i, band := range bands {
+		s[i] = strconv.Itoa(band)
+	}
+	return strings.Join(s, ",")
+}
+
+// ScanBands selects each band in turn and measures the signal, waiting at
+// most wait for a signal on each. Without bands all supported bands are
+// scanned. The bands that were set are restored afterwards.
+func ScanBands(port serial.Port, c Setup, bands []int, wait time.Duration) ([]BandMeasurement, error) {
+	response, err := SendCommand(port, "AT+NBAND?", DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := responseValue(response, "+NBAND:")
+	current := parseBands(value)
+	if len(bands) == 0 {
+		response, err := SendCommand(port, "AT+NBAND=?", DefaultTimeout)
+		if err != nil {
+			return nil, err
+		}
+		value, _ := responseValue(response, "+NBAND:")
+		bands = parseBands(value)
+	}
+
+	var measurements []BandMeasurement
+	for _, band := range bands {
+		m := BandMeasurement{Band: band, RSSI: 99}
+		if err := measureBand(port, c, band, wait, &m); err != nil {
+			m.Error = err.Error()
+		}
+		measurements = append(measurements, m)
+	}
+
+	if len(current) != 0 {
+		if err := selectBands(port, c, bandList(current)); err != nil {
+			return measurements, err
+		}
+	}
+	return measurements, nil
+}
+
+// selectBands sets the bands, which the module only accepts with the radio
+// off. The network is selected again after the radio is switched on, so the
+// measurement is of the operator of the setup on the new band.
+func selectBands(port serial.Port, c Setup, bands string) error {
+	if _, err := SendCommand(port, "AT+CFUN=0", DefaultTimeout); err != nil {
+		return err
+	}
+	if _, err := SendCommand(port, "AT+NBAND="+bands, DefaultTimeout); err != nil {
+		return err
+	}
+	if _, err := SendCommand(port, "AT+CFUN=1", DefaultTimeout); err != nil {
+		return err
+	}
+	return selectOperator(port, c)
+}
+
+// selectOperator runs the AT+COPS requests of the setupnetwork sequence
+func selectOperator(port serial.Port, c Setup) error {
+	for _, v := range c.SetupNetwork {
+		if strings.HasPrefix(v.Request, "AT+COPS") {
+			if _, err := RunRequest(port, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func measureBand(port serial.Port, c Setup, band int, wait time.Duration, m *BandMeasurement) error {
+	if err := selectBands(port, c, strconv.Itoa(band)); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(wait)
+	for m.RSSI == 99 && time.Now().Before(deadline) {
+		response, err := SendCommand(port, "AT+CSQ", DefaultTimeout)
+		if err != nil {
+			return err
+		}
+		if value, ok := responseValue(response, "+CSQ:"); ok {
+			m.RSSI, _ = strconv.Atoi(splitParams(value)[0])
+		}
+		if m.RSSI == 99 {
+			time.Sleep(time.Second)
+		}
+	}
+	if m.RSSI == 99 {
+		return errors.New("no signal")
+	}
+	stats, err := ReadRadioStats(port, c)
+	m.Stats = stats
+	return err
+}
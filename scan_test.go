@@ -0,0 +1,87 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCOPS(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []Operator
+		err   bool
+	}{
+		{`(2,"Vodafone NL","VF NL","20404",9),(1,"T-Mobile NL","TMO NL","20416",9),,(0-4),(0-2)`, []Operator{
+			{Status: 2, Long: "Vodafone NL", Short: "VF NL", Numeric: "20404", AcT: 9},
+			{Status: 1, Long: "T-Mobile NL", Short: "TMO NL", Numeric: "20416", AcT: 9},
+		}, false},
+		{`(3,"KPN","KPN","20408")`, []Operator{{Status: 3, Long: "KPN", Short: "KPN", Numeric: "20408"}}, false},
+		// an operator without a name does not end the list
+		{`(2,"","","20416",9),(1,"Vodafone NL","VF NL","20404",9),,(0-4),(0-2)`, []Operator{
+			{Status: 2, Numeric: "20416", AcT: 9},
+			{Status: 1, Long: "Vodafone NL", Short: "VF NL", Numeric: "20404", AcT: 9},
+		}, false},
+		{`(1,"Op (test)","OT","20499",9),(0-4),(0-2)`, []Operator{
+			{Status: 1, Long: "Op (test)", Short: "OT", Numeric: "20499", AcT: 9},
+		}, false},
+		{`(1,"KPN","KPN","20408",9`, nil, true},
+		{`,,(0-4),(0-2)`, nil, false},
+		{``, nil, false},
+		{`(x,"KPN","KPN","20408",9)`, nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseCOPS(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("ParseCOPS(%q) error %v", test.value, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseCOPS(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestOperatorStatusName(t *testing.T) {
+	for status, want := range map[int]string{0: "unknown", 1: "available", 2: "current", 3: "forbidden", 7: "7"} {
+		if got := (Operator{Status: status}).StatusName(); got != want {
+			t.Errorf("StatusName of %d = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestScanBandsSelectsOperator(t *testing.T) {
+	port := newFakePort(func(request string) []string {
+		switch request {
+		case "AT+NBAND?":
+			return []string{"+NBAND:8,20", "OK"}
+		case "AT+CSQ":
+			return []string{"+CSQ:20,99", "OK"}
+		}
+		return []string{"OK"}
+	})
+	c := Setup{SetupNetwork: []RequestResponse{
+		{Request: "AT+CFUN=1", Response: "OK"},
+		{Request: `AT+COPS=1,2,"20416"`, Response: "OK"},
+	}}
+	measurements, err := ScanBands(port, c, []int{8, 20}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(measurements) != 2 || measurements[0].RSSI != 20 || measurements[1].RSSI != 20 {
+		t.Errorf("measurements %+v", measurements)
+	}
+	// every time the radio is switched on the operator is selected again
+	var selections []string
+	requests := port.Requests()
+	for i, request := range requests {
+		if request == "AT+CFUN=1" && i+1 < len(requests) {
+			selections = append(selections, requests[i+1])
+		}
+	}
+	want := strings.Repeat(`AT+COPS=1,2,"20416" `, 3)
+	if got := strings.Join(selections, " ") + " "; got != want {
+		t.Errorf("requests after CFUN=1: %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,303 @@
+package senbiotpkg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PayloadSchema is a fixed binary layout of sensor values, read from yaml:
+//
+//	name: weather
+//	endian: big
+//	fields:
+//	- {name: temperature, type: int16, scale: 0.01}
+//	- {name: pressure, type: uint16, scale: 0.1, offset: 500}
+//	- {name: door, type: bitfield, bits: 1}
+//	- {name: battery, type: bitfield, bits: 7}
+//
+// The value of a field is raw*scale+offset. Consecutive bitfields are packed
+// from the most significant bit on and padded to whole bytes.
+type PayloadSchema struct {
+	SchemaName string        `yaml:"name"`
+	Endian     string        `yaml:"endian"`
+	Fields     []SchemaField `yaml:"fields"`
+}
+
+// SchemaField is a field of a payload schema. Type is int8, uint8, int16,
+// uint16, int24, uint24, int32, uint32, float (32 bits) or bitfield.
+type SchemaField struct {
+	Name   string  `yaml:"name"`
+	Type   string  `yaml:"type"`
+	Bits   int     `yaml:"bits,omitempty"`
+	Scale  float64 `yaml:"scale,omitempty"`
+	Offset float64 `yaml:"offset,omitempty"`
+	Endian string  `yaml:"endian,omitempty"`
+}
+
+// fieldSize returns the number of bytes of a field type and whether it is signed
+func fieldSize(t string) (int, bool, error) {
+	switch t {
+	case "int8", "uint8":
+		return 1, t[0] == 'i', nil
+	case "int16", "uint16":
+		return 2, t[0] == 'i', nil
+	case "int24", "uint24":
+		return 3, t[0] == 'i', nil
+	case "int32", "uint32":
+		return 4, t[0] == 'i', nil
+	case "float":
+		return 4, true, nil
+	}
+	return 0, false, fmt.Errorf("unknown field type %s", t)
+}
+
+// Name returns the name of the schema, used as payload format
+func (s PayloadSchema) Name() string {
+	if len(s.SchemaName) == 0 {
+		return "schema"
+	}
+	return s.SchemaName
+}
+
+// Validate checks the types, endianness and bitfield sizes of the fields
+func (s PayloadSchema) Validate() error {
+	if len(s.Fields) == 0 {
+		return errors.New("schema has no fields")
+	}
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		if len(f.Name) == 0 {
+			return errors.New("schema field without name")
+		}
+		if names[f.Name] {
+			return fmt.Errorf("schema field %s is defined twice", f.Name)
+		}
+		names[f.Name] = true
+		if f.Type == "bitfield" {
+			if f.Bits < 1 || f.Bits > 32 {
+				return fmt.Errorf("bitfield %s needs 1 to 32 bits", f.Name)
+			}
+		} else if _, _, err := fieldSize(f.Type); err != nil {
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		for _, e := range []string{s.Endian, f.Endian} {
+			if e != "" && e != "big" && e != "little" {
+				return fmt.Errorf("field %s: endian is big or little, not %s", f.Name, e)
+			}
+		}
+	}
+	return nil
+}
+
+// Size returns the length of the payload in bytes
+func (s PayloadSchema) Size() int {
+	size, bits := 0, 0
+	for _, f := range s.Fields {
+		if f.Type == "bitfield" {
+			bits += f.Bits
+			continue
+		}
+		size += (bits + 7) / 8
+		bits = 0
+		n, _, _ := fieldSize(f.Type)
+		size += n
+	}
+	return size + (bits+7)/8
+}
+
+func (s PayloadSchema) byteOrder(f SchemaField) binary.ByteOrder {
+	e := f.Endian
+	if len(e) == 0 {
+		e = s.Endian
+	}
+	if e == "little" {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+func (f SchemaField) scale() float64 {
+	if f.Scale == 0 {
+		return 1
+	}
+	return f.Scale
+}
+
+// EncodeRecord packs the values of the record into the layout of the schema,
+// the record has a value for each field
+func (s PayloadSchema) EncodeRecord(record map[string]float64) ([]byte, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	for name := range record {
+		if !s.hasField(name) {
+			return nil, fmt.Errorf("%s is not a field of schema %s", name, s.Name())
+		}
+	}
+	for _, f := range s.Fields {
+		if _, ok := record[f.Name]; !ok {
+			return nil, fmt.Errorf("record has no value for %s", f.Name)
+		}
+	}
+	var buf []byte
+	var acc uint64
+	bits := 0
+	flush := func() {
+		if bits%8 != 0 {
+			acc <<= uint(8 - bits%8)
+			bits += 8 - bits%8
+		}
+		for bits > 0 {
+			bits -= 8
+			buf = append(buf, byte(acc>>uint(bits)))
+		}
+		acc = 0
+	}
+	for _, f := range s.Fields {
+		value := record[f.Name]
+		if f.Type == "float" {
+			flush()
+			b := make([]byte, 4)
+			s.byteOrder(f).PutUint32(b, math.Float32bits(float32((value-f.Offset)/f.scale())))
+			buf = append(buf, b...)
+			continue
+		}
+		raw := int64(math.Round((value - f.Offset) / f.scale()))
+		if f.Type == "bitfield" {
+			if raw < 0 || raw >= int64(1)<<uint(f.Bits) {
+				return nil, fmt.Errorf("%s %v does not fit in %d bits", f.Name, value, f.Bits)
+			}
+			acc = acc<<uint(f.Bits) | uint64(raw)
+			bits += f.Bits
+			if bits >= 32 {
+				// keep the accumulator below 64 bits
+				for bits >= 8 {
+					bits -= 8
+					buf = append(buf, byte(acc>>uint(bits)))
+				}
+			}
+			continue
+		}
+		flush()
+		size, signed, _ := fieldSize(f.Type)
+		width := uint(size * 8)
+		min, max := int64(0), int64(1)<<width-1
+		if signed {
+			min, max = -(int64(1) << (width - 1)), int64(1)<<(width-1)-1
+		}
+		if raw < min || raw > max {
+			return nil, fmt.Errorf("%s %v is out of range of %s", f.Name, value, f.Type)
+		}
+		b := make([]byte, 8)
+		s.byteOrder(f).PutUint64(b, uint64(raw))
+		if s.byteOrder(f) == binary.BigEndian {
+			buf = append(buf, b[8-size:]...)
+		} else {
+			buf = append(buf, b[:size]...)
+		}
+	}
+	flush()
+	return buf, nil
+}
+
+func (s PayloadSchema) hasField(name string) bool {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeRecord unpacks a payload with the layout of the schema
+func (s PayloadSchema) DecodeRecord(payload []byte) (map[string]float64, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if len(payload) != s.Size() {
+		return nil, fmt.Errorf("payload of %d bytes does not match schema %s of %d bytes", len(payload), s.Name(), s.Size())
+	}
+	record := make(map[string]float64)
+	pos, bit := 0, 0
+	for _, f := range s.Fields {
+		if f.Type == "bitfield" {
+			var raw uint64
+			for i := 0; i < f.Bits; i++ {
+				b := payload[pos+(bit+i)/8] >> uint(7-(bit+i)%8) & 1
+				raw = raw<<1 | uint64(b)
+			}
+			bit += f.Bits
+			record[f.Name] = float64(raw)*f.scale() + f.Offset
+			continue
+		}
+		pos += (bit + 7) / 8
+		bit = 0
+		size, signed, _ := fieldSize(f.Type)
+		b := make([]byte, 8)
+		if s.byteOrder(f) == binary.BigEndian {
+			copy(b[8-size:], payload[pos:pos+size])
+		} else {
+			copy(b, payload[pos:pos+size])
+		}
+		raw := s.byteOrder(f).Uint64(b)
+		pos += size
+		if f.Type == "float" {
+			record[f.Name] = float64(math.Float32frombits(uint32(raw)))*f.scale() + f.Offset
+			continue
+		}
+		v := int64(raw)
+		if width := uint(size * 8); signed && v >= int64(1)<<(width-1) {
+			v -= int64(1) << width
+		}
+		record[f.Name] = float64(v)*f.scale() + f.Offset
+	}
+	return record, nil
+}
+
+// ParseRecord reads a record as a JSON object of numbers or as key=value
+// pairs separated by commas or white space
+func ParseRecord(data []byte) (map[string]float64, error) {
+	text := strings.TrimSpace(string(data))
+	record := make(map[string]float64)
+	if strings.HasPrefix(text, "{") {
+		err := json.Unmarshal([]byte(text), &record)
+		return record, err
+	}
+	for _, pair := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		i := strings.Index(pair, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%q is not key=value", pair)
+		}
+		v, err := strconv.ParseFloat(pair[i+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pair[:i], err)
+		}
+		record[pair[:i]] = v
+	}
+	return record, nil
+}
+
+// Encode turns a JSON or key=value record into the payload
+func (s PayloadSchema) Encode(data []byte) ([]byte, error) {
+	record, err := ParseRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.EncodeRecord(record)
+}
+
+// Decode turns the payload into a JSON record
+func (s PayloadSchema) Decode(payload []byte) ([]byte, error) {
+	record, err := s.DecodeRecord(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(record, "", "  ")
+}
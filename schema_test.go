@@ -0,0 +1,148 @@
+package senbiotpkg
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+var weatherSchema = PayloadSchema{
+	SchemaName: "weather",
+	Endian:     "big",
+	Fields: []SchemaField{
+		{Name: "temperature", Type: "int16", Scale: 0.01},
+		{Name: "pressure", Type: "uint16", Scale: 0.1, Offset: 500},
+		{Name: "door", Type: "bitfield", Bits: 1},
+		{Name: "battery", Type: "bitfield", Bits: 7},
+	},
+}
+
+func TestPayloadSchema(t *testing.T) {
+	tests := []struct {
+		schema  PayloadSchema
+		record  map[string]float64
+		payload string
+	}{
+		{weatherSchema, map[string]float64{"temperature": 21.53, "pressure": 1013.2, "door": 1, "battery": 100}, "0869140ce4"},
+		{weatherSchema, map[string]float64{"temperature": -10, "pressure": 500, "door": 0, "battery": 0}, "fc18000000"},
+		{PayloadSchema{Endian: "little", Fields: []SchemaField{
+			{Name: "a", Type: "uint16"},
+			{Name: "b", Type: "int24"},
+			{Name: "c", Type: "uint32", Endian: "big"},
+			{Name: "d", Type: "float"},
+			{Name: "e", Type: "int8"},
+		}}, map[string]float64{"a": 0x1234, "b": -2, "c": 0xdeadbeef, "d": 1.5, "e": -128}, "3412feffffdeadbeef0000c03f80"},
+		{PayloadSchema{Fields: []SchemaField{
+			{Name: "flag", Type: "bitfield", Bits: 3},
+			{Name: "count", Type: "uint8"},
+			{Name: "x", Type: "bitfield", Bits: 20},
+			{Name: "y", Type: "bitfield", Bits: 20},
+			{Name: "z", Type: "bitfield", Bits: 5},
+		}}, map[string]float64{"flag": 5, "count": 7, "x": 0xfffff, "y": 1, "z": 31}, "a007fffff00001f8"},
+	}
+	for _, test := range tests {
+		payload, err := test.schema.EncodeRecord(test.record)
+		if err != nil || hex.EncodeToString(payload) != test.payload {
+			t.Errorf("%s EncodeRecord(%v) = %x, %v, want %s", test.schema.Name(), test.record, payload, err, test.payload)
+			continue
+		}
+		if len(payload) != test.schema.Size() {
+			t.Errorf("%s Size() = %d, payload has %d bytes", test.schema.Name(), test.schema.Size(), len(payload))
+		}
+		record, err := test.schema.DecodeRecord(payload)
+		if err != nil {
+			t.Errorf("%s DecodeRecord(%x): %v", test.schema.Name(), payload, err)
+			continue
+		}
+		for name, want := range test.record {
+			if math.Abs(record[name]-want) > 1e-9 {
+				t.Errorf("%s DecodeRecord(%x) %s = %v, want %v", test.schema.Name(), payload, name, record[name], want)
+			}
+		}
+	}
+}
+
+func TestPayloadSchemaErrors(t *testing.T) {
+	invalid := []PayloadSchema{
+		{},
+		{Fields: []SchemaField{{Type: "uint8"}}},
+		{Fields: []SchemaField{{Name: "a", Type: "uint8"}, {Name: "a", Type: "int8"}}},
+		{Fields: []SchemaField{{Name: "a", Type: "uint64"}}},
+		{Fields: []SchemaField{{Name: "a", Type: "bitfield"}}},
+		{Fields: []SchemaField{{Name: "a", Type: "bitfield", Bits: 33}}},
+		{Endian: "middle", Fields: []SchemaField{{Name: "a", Type: "uint8"}}},
+		{Fields: []SchemaField{{Name: "a", Type: "uint8", Endian: "network"}}},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("invalid schema %+v accepted", s)
+		}
+	}
+
+	records := []map[string]float64{
+		{"temperature": 21, "pressure": 1000, "door": 1},
+		{"temperature": 21, "pressure": 1000, "door": 1, "battery": 50, "wind": 3},
+		{"temperature": 400, "pressure": 1000, "door": 1, "battery": 50},
+		{"temperature": 21, "pressure": 400, "door": 1, "battery": 50},
+		{"temperature": 21, "pressure": 1000, "door": 2, "battery": 50},
+		{"temperature": 21, "pressure": 1000, "door": 1, "battery": -1},
+	}
+	for _, record := range records {
+		if payload, err := weatherSchema.EncodeRecord(record); err == nil {
+			t.Errorf("EncodeRecord(%v) = %x, want an error", record, payload)
+		}
+	}
+	for _, payload := range []string{"0869140c", "0869140ce400"} {
+		data, _ := hex.DecodeString(payload)
+		if _, err := weatherSchema.DecodeRecord(data); err == nil {
+			t.Errorf("DecodeRecord(%s) accepted", payload)
+		}
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	tests := []struct {
+		data string
+		want map[string]float64
+		err  bool
+	}{
+		{`{"temperature": 21.5, "door": 1}`, map[string]float64{"temperature": 21.5, "door": 1}, false},
+		{"temperature=21.5, door=1\nbattery=80", map[string]float64{"temperature": 21.5, "door": 1, "battery": 80}, false},
+		{"", map[string]float64{}, false},
+		{"temperature", nil, true},
+		{"=21.5", nil, true},
+		{"temperature=warm", nil, true},
+		{`{"temperature": "21.5"}`, nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseRecord([]byte(test.data))
+		if (err != nil) != test.err {
+			t.Errorf("ParseRecord(%q) error %v", test.data, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("ParseRecord(%q) = %v, want %v", test.data, got, test.want)
+		}
+		for name, want := range test.want {
+			if got[name] != want {
+				t.Errorf("ParseRecord(%q) = %v, want %v", test.data, got, test.want)
+			}
+		}
+	}
+}
+
+func TestPayloadSchemaFormat(t *testing.T) {
+	payload, err := weatherSchema.Encode([]byte("temperature=21.53 pressure=1013.2 door=1 battery=100"))
+	if err != nil || hex.EncodeToString(payload) != "0869140ce4" {
+		t.Fatalf("Encode = %x, %v", payload, err)
+	}
+	if _, err := weatherSchema.Decode(payload); err != nil {
+		t.Error(err)
+	}
+	if weatherSchema.Name() != "weather" || (PayloadSchema{}).Name() != "schema" {
+		t.Error("wrong schema name")
+	}
+}
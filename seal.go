@@ -0,0 +1,284 @@
+package senbiotpkg
+
+import (
+	"bufio"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A sealed payload is encrypted and authenticated with AES-CCM:
+//
+//	SealMarker, device id (4 bytes), counter (4 bytes), ciphertext, 8 byte tag
+//
+// The nonce is the device id, 5 zero bytes and the counter, the header is
+// authenticated as additional data. The counter of a device is persisted so
+// a nonce is never used twice with the same key.
+const (
+	SealMarker     = 0xe0
+	SealHeaderSize = 9
+	SealTagSize    = 8
+)
+
+// Keys are the AES keys of devices by device id
+type Keys map[uint32][]byte
+
+// LoadKeys reads a key file with a line "<device id> <hex key>" for each
+// device, the key is 16, 24 or 32 bytes. Empty lines and lines starting with
+// # are skipped.
+func LoadKeys(file string) (Keys, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys := make(Keys)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want <device id> <hex key>", file, n)
+		}
+		id, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid device id %s", file, n, fields[0])
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		keys[uint32(id)] = key
+	}
+	return keys, scanner.Err()
+}
+
+// Device returns the only device of a key file, as the key file of a sender has
+func (k Keys) Device() (uint32, []byte, error) {
+	if len(k) != 1 {
+		return 0, nil, fmt.Errorf("key file has %d devices instead of one", len(k))
+	}
+	for id, key := range k {
+		return id, key, nil
+	}
+	return 0, nil, nil
+}
+
+// Counter is a message counter persisted in a file
+type Counter struct {
+	File string
+	mu   sync.Mutex
+}
+
+// Next returns the next value of the counter. The value is written to the
+// file before it is returned, so it is not used again after a restart.
+func (c *Counter) Next() (uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n uint64
+	d, err := ioutil.ReadFile(c.File)
+	if err == nil {
+		if n, err = strconv.ParseUint(strings.TrimSpace(string(d)), 10, 32); err != nil {
+			return 0, fmt.Errorf("%s: %v", c.File, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+	if n == 0xffffffff {
+		return 0, fmt.Errorf("%s: counter is used up, a new key is needed", c.File)
+	}
+	n++
+	if err := writeFileSync(c.File, []byte(strconv.FormatUint(n, 10)+"\n")); err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
+
+// writeFileSync writes the file through a temporary file, so it is never
+// left half written
+func writeFileSync(file string, data []byte) error {
+	tmp := file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func sealNonce(device, counter uint32) []byte {
+	nonce := make([]byte, 13)
+	binary.BigEndian.PutUint32(nonce, device)
+	binary.BigEndian.PutUint32(nonce[9:], counter)
+	return nonce
+}
+
+// SealPayload encrypts the payload of the device with the next value of counter
+func SealPayload(device uint32, key []byte, counter *Counter, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := NewCCM(block, SealTagSize, 13)
+	if err != nil {
+		return nil, err
+	}
+	n, err := counter.Next()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, SealHeaderSize)
+	header[0] = SealMarker
+	binary.BigEndian.PutUint32(header[1:], device)
+	binary.BigEndian.PutUint32(header[5:], n)
+	return aead.Seal(header, sealNonce(device, n), payload, header), nil
+}
+
+// IsSealed reports whether the payload starts with a seal header
+func IsSealed(payload []byte) bool {
+	return len(payload) >= SealHeaderSize+SealTagSize && payload[0] == SealMarker
+}
+
+// ErrReplay is returned for a sealed payload that was received before
+var ErrReplay = errors.New("payload was received before")
+
+// OpenPayload decrypts a sealed payload with the key of its device and
+// returns the device, the counter and the payload. With a guard the counter
+// is checked against the counters received before.
+func OpenPayload(keys Keys, guard *ReplayGuard, sealed []byte) (uint32, uint32, []byte, error) {
+	if !IsSealed(sealed) {
+		return 0, 0, nil, errors.New("payload is not sealed")
+	}
+	device := binary.BigEndian.Uint32(sealed[1:])
+	n := binary.BigEndian.Uint32(sealed[5:])
+	key, ok := keys[device]
+	if !ok {
+		return device, n, nil, fmt.Errorf("no key for device %d", device)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return device, n, nil, err
+	}
+	aead, err := NewCCM(block, SealTagSize, 13)
+	if err != nil {
+		return device, n, nil, err
+	}
+	header := sealed[:SealHeaderSize]
+	payload, err := aead.Open(nil, sealNonce(device, n), sealed[SealHeaderSize:], header)
+	if err != nil {
+		return device, n, nil, err
+	}
+	// only an authentic counter may move the window
+	if guard != nil && !guard.Accept(device, n) {
+		return device, n, nil, ErrReplay
+	}
+	return device, n, payload, nil
+}
+
+// ReplayWindow is the number of counters below the highest one that are
+// still accepted when they arrive out of order
+const ReplayWindow = 64
+
+// ReplayGuard remembers the counters received of each device: the highest
+// one and a bitmap of the ReplayWindow before it
+type ReplayGuard struct {
+	mu      sync.Mutex
+	highest map[uint32]uint32
+	seen    map[uint32]uint64
+}
+
+// NewReplayGuard returns a guard that has not received anything
+func NewReplayGuard() *ReplayGuard {
+	return &ReplayGuard{highest: make(map[uint32]uint32), seen: make(map[uint32]uint64)}
+}
+
+// Accept reports whether counter n of the device was not received before
+// and is not too old, and remembers it
+func (g *ReplayGuard) Accept(device, n uint32) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	highest, ok := g.highest[device]
+	switch {
+	case !ok || n > highest:
+		shift := uint64(n - highest)
+		if !ok || shift >= ReplayWindow {
+			g.seen[device] = 1
+		} else {
+			g.seen[device] = g.seen[device]<<shift | 1
+		}
+		g.highest[device] = n
+		return true
+	case highest-n >= ReplayWindow:
+		return false
+	}
+	bit := uint64(1) << (highest - n)
+	if g.seen[device]&bit != 0 {
+		return false
+	}
+	g.seen[device] |= bit
+	return true
+}
+
+// LoadReplayGuard reads a guard saved with Save, a missing file is an empty guard
+func LoadReplayGuard(file string) (*ReplayGuard, error) {
+	g := NewReplayGuard()
+	d, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for n, line := range strings.Split(string(d), "\n") {
+		var device, highest uint32
+		var seen uint64
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if _, err := fmt.Sscanf(line, "%d %d %x", &device, &highest, &seen); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n+1, err)
+		}
+		g.highest[device], g.seen[device] = highest, seen
+	}
+	return g, nil
+}
+
+// Save writes the counters of the guard to file, one device per line
+func (g *ReplayGuard) Save(file string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	devices := make([]uint32, 0, len(g.highest))
+	for device := range g.highest {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i] < devices[j] })
+	var b strings.Builder
+	for _, device := range devices {
+		fmt.Fprintf(&b, "%d %d %x\n", device, g.highest[device], g.seen[device])
+	}
+	return writeFileSync(file, []byte(b.String()))
+}
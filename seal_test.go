@@ -0,0 +1,122 @@
+package senbiotpkg
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayGuardAccept(t *testing.T) {
+	tests := []struct {
+		name     string
+		counters []uint32
+		want     []bool
+	}{
+		{"in order", []uint32{1, 2, 3}, []bool{true, true, true}},
+		{"duplicate", []uint32{5, 5}, []bool{true, false}},
+		{"out of order", []uint32{10, 8, 9, 8}, []bool{true, true, true, false}},
+		{"gap", []uint32{1, 100, 50, 37, 36, 99}, []bool{true, true, true, true, false, true}},
+		{"too old", []uint32{100, 36, 37}, []bool{true, false, true}},
+		{"far ahead", []uint32{1, 1000, 1, 999}, []bool{true, true, false, true}},
+		{"zero", []uint32{0, 0, 1}, []bool{true, false, true}},
+		{"wraps", []uint32{0xffffffff, 0}, []bool{true, false}},
+	}
+	for _, test := range tests {
+		g := NewReplayGuard()
+		for i, n := range test.counters {
+			if got := g.Accept(1, n); got != test.want[i] {
+				t.Errorf("%s: Accept(%d) = %v, want %v", test.name, n, got, test.want[i])
+			}
+		}
+	}
+
+	g := NewReplayGuard()
+	if !g.Accept(1, 7) || !g.Accept(2, 7) {
+		t.Error("the same counter of another device was not accepted")
+	}
+}
+
+func TestReplayGuardSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "replay")
+	g, err := LoadReplayGuard(file)
+	if err != nil {
+		t.Fatalf("LoadReplayGuard of a missing file: %v", err)
+	}
+	for _, n := range []uint32{10, 12, 7} {
+		g.Accept(1, n)
+	}
+	g.Accept(2, 3)
+	if err := g.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadReplayGuard(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		device, n uint32
+		want      bool
+	}{
+		{1, 12, false},
+		{1, 10, false},
+		{1, 7, false},
+		{1, 11, true},
+		{1, 13, true},
+		{2, 3, false},
+		{2, 4, true},
+		{3, 1, true},
+	}
+	for _, test := range tests {
+		if got := loaded.Accept(test.device, test.n); got != test.want {
+			t.Errorf("after Save, Accept(%d, %d) = %v, want %v", test.device, test.n, got, test.want)
+		}
+	}
+}
+
+func TestSealPayload(t *testing.T) {
+	dir := t.TempDir()
+	key := unhex(t, "000102030405060708090a0b0c0d0e0f")
+	keys := Keys{42: key}
+	counter := &Counter{File: filepath.Join(dir, "counter")}
+	guard := NewReplayGuard()
+	payload := []byte("temperature 21.5")
+
+	sealed, err := SealPayload(42, key, counter, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || len(sealed) != SealHeaderSize+len(payload)+SealTagSize {
+		t.Fatalf("SealPayload = %x, not a sealed payload of %d bytes", sealed, len(payload))
+	}
+	device, n, opened, err := OpenPayload(keys, guard, sealed)
+	if err != nil || device != 42 || n != 1 || !bytes.Equal(opened, payload) {
+		t.Errorf("OpenPayload = %d, %d, %q, %v, want 42, 1, %q", device, n, opened, err, payload)
+	}
+	if _, _, _, err := OpenPayload(keys, guard, sealed); err != ErrReplay {
+		t.Errorf("OpenPayload again = %v, want ErrReplay", err)
+	}
+
+	next, err := SealPayload(42, key, counter, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(next[SealHeaderSize:], sealed[SealHeaderSize:]) {
+		t.Error("the same payload sealed twice gave the same ciphertext")
+	}
+	// a forged counter must not move the replay window
+	forged := append([]byte(nil), next...)
+	forged[8] = 0x40
+	if _, _, _, err := OpenPayload(keys, guard, forged); err == nil {
+		t.Error("OpenPayload of a changed header succeeded")
+	}
+	if _, n, _, err := OpenPayload(keys, guard, next); err != nil || n != 2 {
+		t.Errorf("OpenPayload of the next payload = %d, %v", n, err)
+	}
+
+	if _, _, _, err := OpenPayload(Keys{7: key}, nil, sealed); err == nil {
+		t.Error("OpenPayload without the key of the device succeeded")
+	}
+	if _, _, _, err := OpenPayload(keys, nil, payload); err == nil {
+		t.Error("OpenPayload of an unsealed payload succeeded")
+	}
+}
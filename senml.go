@@ -0,0 +1,287 @@
+package senbiotpkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// SenML (RFC 8428) records, in JSON with the short field names and in CBOR
+// with the integer labels of the RFC.
+
+// SenMLRecord is one record of a SenML pack. Value, StringValue, BoolValue,
+// DataValue and Sum are pointers or empty when the record does not have them.
+type SenMLRecord struct {
+	BaseName    string   `json:"bn,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty"`
+	BaseUnit    string   `json:"bu,omitempty"`
+	BaseValue   float64  `json:"bv,omitempty"`
+	BaseSum     float64  `json:"bs,omitempty"`
+	BaseVersion int      `json:"bver,omitempty"`
+	Name        string   `json:"n,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	// DataValue is base64url without padding, as in SenML JSON
+	DataValue  string   `json:"vd,omitempty"`
+	Sum        *float64 `json:"s,omitempty"`
+	Time       float64  `json:"t,omitempty"`
+	UpdateTime float64  `json:"ut,omitempty"`
+}
+
+// SenMLPack is a list of SenML records
+type SenMLPack []SenMLRecord
+
+// CBOR labels of RFC 8428 section 6
+const (
+	senmlBaseVersion = -1
+	senmlBaseName    = -2
+	senmlBaseTime    = -3
+	senmlBaseUnit    = -4
+	senmlBaseValue   = -5
+	senmlBaseSum     = -6
+	senmlName        = 0
+	senmlUnit        = 1
+	senmlValue       = 2
+	senmlStringValue = 3
+	senmlBoolValue   = 4
+	senmlSum         = 5
+	senmlTime        = 6
+	senmlUpdateTime  = 7
+	senmlDataValue   = 8
+)
+
+// senmlTextLabels are the labels of the fields when a CBOR pack names them
+// with their JSON text, as it does for extension fields
+var senmlTextLabels = map[string]int64{
+	"bver": senmlBaseVersion, "bn": senmlBaseName, "bt": senmlBaseTime, "bu": senmlBaseUnit,
+	"bv": senmlBaseValue, "bs": senmlBaseSum, "n": senmlName, "u": senmlUnit, "v": senmlValue,
+	"vs": senmlStringValue, "vb": senmlBoolValue, "s": senmlSum, "t": senmlTime,
+	"ut": senmlUpdateTime, "vd": senmlDataValue,
+}
+
+func init() {
+	RegisterFormat(senmlFormat{})
+}
+
+// senmlFormat turns SenML JSON into SenML CBOR
+type senmlFormat struct{}
+
+func (senmlFormat) Name() string { return "senml" }
+
+func (senmlFormat) Encode(data []byte) ([]byte, error) {
+	pack, err := DecodeSenMLJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeSenMLCBOR(pack)
+}
+
+func (senmlFormat) Decode(payload []byte) ([]byte, error) {
+	pack, err := DecodeSenMLCBOR(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(pack, "", "  ")
+}
+
+// EncodeSenMLJSON encodes the pack as SenML JSON
+func EncodeSenMLJSON(pack SenMLPack) ([]byte, error) {
+	return json.Marshal(pack)
+}
+
+// DecodeSenMLJSON decodes a SenML JSON pack
+func DecodeSenMLJSON(data []byte) (SenMLPack, error) {
+	var pack SenMLPack
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return nil, err
+	}
+	for i, r := range pack {
+		if _, err := base64.RawURLEncoding.DecodeString(r.DataValue); err != nil {
+			return nil, fmt.Errorf("SenML record %d: vd: %v", i, err)
+		}
+	}
+	return pack, nil
+}
+
+// EncodeSenMLCBOR encodes the pack as SenML CBOR
+func EncodeSenMLCBOR(pack SenMLPack) ([]byte, error) {
+	records := make([]interface{}, len(pack))
+	for i, r := range pack {
+		m := make(map[interface{}]interface{})
+		text := func(label int, v string) {
+			if len(v) != 0 {
+				m[label] = v
+			}
+		}
+		number := func(label int, v float64) {
+			if v != 0 {
+				m[label] = cborNumber(v)
+			}
+		}
+		text(senmlBaseName, r.BaseName)
+		number(senmlBaseTime, r.BaseTime)
+		text(senmlBaseUnit, r.BaseUnit)
+		number(senmlBaseValue, r.BaseValue)
+		number(senmlBaseSum, r.BaseSum)
+		if r.BaseVersion != 0 {
+			m[senmlBaseVersion] = r.BaseVersion
+		}
+		text(senmlName, r.Name)
+		text(senmlUnit, r.Unit)
+		if r.Value != nil {
+			m[senmlValue] = cborNumber(*r.Value)
+		}
+		if r.StringValue != nil {
+			m[senmlStringValue] = *r.StringValue
+		}
+		if r.BoolValue != nil {
+			m[senmlBoolValue] = *r.BoolValue
+		}
+		if len(r.DataValue) != 0 {
+			data, err := base64.RawURLEncoding.DecodeString(r.DataValue)
+			if err != nil {
+				return nil, fmt.Errorf("SenML record %d: vd: %v", i, err)
+			}
+			m[senmlDataValue] = data
+		}
+		if r.Sum != nil {
+			m[senmlSum] = cborNumber(*r.Sum)
+		}
+		number(senmlTime, r.Time)
+		number(senmlUpdateTime, r.UpdateTime)
+		records[i] = m
+	}
+	return MarshalCBOR(records)
+}
+
+// cborNumber returns whole numbers as integers, which are shorter in CBOR
+func cborNumber(f float64) interface{} {
+	if f == float64(int64(f)) && f >= -1<<53 && f <= 1<<53 {
+		return int64(f)
+	}
+	return f
+}
+
+// DecodeSenMLCBOR decodes a SenML CBOR pack. Labels of extensions, integer
+// or text, are skipped.
+func DecodeSenMLCBOR(payload []byte) (SenMLPack, error) {
+	v, err := UnmarshalCBOR(payload)
+	if err != nil {
+		return nil, err
+	}
+	records, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("SenML CBOR is not an array but %T", v)
+	}
+	pack := make(SenMLPack, len(records))
+	for i, item := range records {
+		m, ok := item.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("SenML record %d is not a map but %T", i, item)
+		}
+		r := &pack[i]
+		for key, value := range m {
+			var label int64
+			switch key := key.(type) {
+			case int64:
+				label = key
+			case string:
+				known, ok := senmlTextLabels[key]
+				if !ok {
+					continue
+				}
+				label = known
+			default:
+				return nil, fmt.Errorf("SenML record %d: invalid label %v", i, key)
+			}
+			var err error
+			switch label {
+			case senmlBaseName:
+				r.BaseName, err = senmlText(value)
+			case senmlBaseTime:
+				r.BaseTime, err = senmlFloat(value)
+			case senmlBaseUnit:
+				r.BaseUnit, err = senmlText(value)
+			case senmlBaseValue:
+				r.BaseValue, err = senmlFloat(value)
+			case senmlBaseSum:
+				r.BaseSum, err = senmlFloat(value)
+			case senmlBaseVersion:
+				var f float64
+				f, err = senmlFloat(value)
+				r.BaseVersion = int(f)
+			case senmlName:
+				r.Name, err = senmlText(value)
+			case senmlUnit:
+				r.Unit, err = senmlText(value)
+			case senmlValue:
+				var f float64
+				f, err = senmlFloat(value)
+				r.Value = &f
+			case senmlStringValue:
+				var s string
+				s, err = senmlText(value)
+				r.StringValue = &s
+			case senmlBoolValue:
+				b, ok := value.(bool)
+				if !ok {
+					err = fmt.Errorf("%v is not a boolean", value)
+				}
+				r.BoolValue = &b
+			case senmlDataValue:
+				data, ok := value.([]byte)
+				if !ok {
+					err = fmt.Errorf("%v is not a byte string", value)
+				}
+				r.DataValue = base64.RawURLEncoding.EncodeToString(data)
+			case senmlSum:
+				var f float64
+				f, err = senmlFloat(value)
+				r.Sum = &f
+			case senmlTime:
+				r.Time, err = senmlFloat(value)
+			case senmlUpdateTime:
+				r.UpdateTime, err = senmlFloat(value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("SenML record %d label %d: %v", i, label, err)
+			}
+		}
+	}
+	return pack, nil
+}
+
+func senmlText(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%v is not a text string", v)
+	}
+	return s, nil
+}
+
+func senmlFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// SenMLSizes returns the size of the pack as SenML JSON and as SenML CBOR
+func SenMLSizes(pack SenMLPack) (int, int, error) {
+	j, err := EncodeSenMLJSON(pack)
+	if err != nil {
+		return 0, 0, err
+	}
+	c, err := EncodeSenMLCBOR(pack)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(j), len(c), nil
+}
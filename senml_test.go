@@ -0,0 +1,87 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSenMLRoundTrip(t *testing.T) {
+	tests := []string{
+		// the examples of RFC 8428 section 5.1
+		`[{"bn":"urn:dev:ow:10e2073a01080063","n":"voltage","u":"V","v":120.1},{"n":"current","u":"A","v":1.2}]`,
+		`[{"bn":"urn:dev:ow:10e2073a0108006:","bt":1276020076.001,"bu":"A","bver":5,"n":"voltage","u":"V","v":120.1},` +
+			`{"n":"current","t":-5,"v":1.2},{"n":"current","t":-4,"v":1.3}]`,
+		`[{"bn":"urn:dev:ow:10e2073a01080063:","n":"temperature","u":"Cel","v":23.1,"t":1276020000.5},` +
+			`{"n":"label","vs":"Machine Room"},{"n":"open","vb":false},{"n":"nfc-reader","vd":"aGkgCg"},` +
+			`{"n":"energy","u":"kWh","s":1.5,"ut":60,"bs":100,"bv":-3}]`,
+	}
+	for _, test := range tests {
+		pack, err := DecodeSenMLJSON([]byte(test))
+		if err != nil {
+			t.Fatalf("DecodeSenMLJSON(%s): %v", test, err)
+		}
+		payload, err := EncodeSenMLCBOR(pack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeSenMLCBOR(payload)
+		if err != nil {
+			t.Fatalf("DecodeSenMLCBOR(%x): %v", payload, err)
+		}
+		if !reflect.DeepEqual(decoded, pack) {
+			t.Errorf("round trip of %s\ngot  %+v\nwant %+v", test, decoded, pack)
+		}
+		j, c, err := SenMLSizes(pack)
+		if err != nil || c >= j {
+			t.Errorf("SenMLSizes = %d, %d, %v, CBOR should be smaller", j, c, err)
+		}
+	}
+}
+
+func TestDecodeSenMLCBORLabels(t *testing.T) {
+	value := 21.5
+	payload, err := MarshalCBOR([]interface{}{map[interface{}]interface{}{
+		"n":         "temperature",
+		int64(2):    value,
+		"ext":       "kept out",
+		int64(-99):  int64(1),
+		int64(1):    "Cel",
+		"bn":        "device:",
+		int64(4242): true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack, err := DecodeSenMLCBOR(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SenMLPack{{BaseName: "device:", Name: "temperature", Unit: "Cel", Value: &value}}
+	if !reflect.DeepEqual(pack, want) {
+		t.Errorf("got %+v, want %+v", pack, want)
+	}
+}
+
+func TestDecodeSenMLCBORErrors(t *testing.T) {
+	tests := []interface{}{
+		map[interface{}]interface{}{int64(0): "n"},
+		[]interface{}{"record"},
+		[]interface{}{map[interface{}]interface{}{true: "n"}},
+		[]interface{}{map[interface{}]interface{}{int64(0): int64(1)}},
+		[]interface{}{map[interface{}]interface{}{"v": "21.5"}},
+		[]interface{}{map[interface{}]interface{}{int64(4): "true"}},
+		[]interface{}{map[interface{}]interface{}{int64(8): "aGkgCg"}},
+	}
+	for _, test := range tests {
+		payload, err := MarshalCBOR(test)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pack, err := DecodeSenMLCBOR(payload); err == nil {
+			t.Errorf("DecodeSenMLCBOR(%v) = %+v, want an error", test, pack)
+		}
+	}
+	if _, err := DecodeSenMLJSON([]byte(`[{"n":"x","vd":"not base64!"}]`)); err == nil {
+		t.Error("invalid vd accepted")
+	}
+}
@@ -1,61 +1,186 @@
 package senbiotpkg
 
 import (
+	"errors"
 	"fmt"
 	"go.bug.st/serial.v1"
+	"io"
 	"log"
+	"strings"
+	"sync"
 	"time"
 )
 
+// DefaultTimeout is how long SendCommand waits for the final result code
+var DefaultTimeout = 10 * time.Second
+
+// ErrTimeout is returned when the device does not answer in time
+var ErrTimeout = errors.New("timeout waiting for response")
+
+// CommandError is returned when the device answers a command with ERROR
+type CommandError struct {
+	Request  string
+	Response string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.Request, e.Response)
+}
+
+type portLine struct {
+	line string
+	err  error
+}
+
+var (
+	linesMu sync.Mutex
+	lines   = make(map[serial.Port]chan portLine)
+)
+
+// portLines returns the lines read from port. Every port has a single reader,
+// so a line that arrives after a timeout is kept for the next caller.
+func portLines(port serial.Port) chan portLine {
+	linesMu.Lock()
+	defer linesMu.Unlock()
+	ch, ok := lines[port]
+	if !ok {
+		ch = make(chan portLine, 64)
+		lines[port] = ch
+		go readLines(port, ch)
+	}
+	return ch
+}
+
+func readLines(port serial.Port, ch chan portLine) {
+	buff := make([]byte, 1)
+	var line []byte
+	for {
+		n, err := port.Read(buff)
+		if err == nil && n == 0 {
+			err = io.EOF
+		}
+		if err != nil {
+			linesMu.Lock()
+			delete(lines, port)
+			linesMu.Unlock()
+			ch <- portLine{err: err}
+			return
+		}
+		switch buff[0] {
+		case '\r':
+		case '\n':
+			if len(line) > 0 {
+				ch <- portLine{line: string(line)}
+				line = nil
+			}
+		default:
+			line = append(line, buff[0])
+		}
+	}
+}
+
+// readLine returns the next non empty line, a zero deadline waits forever
+func readLine(port serial.Port, deadline time.Time) (string, error) {
+	if deadline.IsZero() {
+		l := <-portLines(port)
+		return l.line, l.err
+	}
+	wait := time.Until(deadline)
+	if wait <= 0 {
+		return "", ErrTimeout
+	}
+	select {
+	case l := <-portLines(port):
+		return l.line, l.err
+	case <-time.After(wait):
+		return "", ErrTimeout
+	}
+}
+
+// ReadLine returns the next non empty line sent by the device
+func ReadLine(port serial.Port, timeout time.Duration) (string, error) {
+	return readLine(port, time.Now().Add(timeout))
+}
+
+// ReadResponse reads the answer of the device up to the final result code
+// and returns its first line
 func ReadResponse(port serial.Port) (response string) {
-	var n int
-	var err error
-	buff := make([]byte, 10)
-	var stringbuff string
-	var noofreturns int = 0
+	result := readResult(port, "", "")
+	if len(result) == 0 {
+		return ""
+	}
+	return result[0]
+}
 
+// readResult reads the lines of an answer to request up to the final result
+// code, or up to expected when it is set. The echo of request is skipped.
+// Reading the whole answer keeps its OK from being taken as the answer to
+// the next command.
+func readResult(port serial.Port, request, expected string) []string {
+	var result []string
 	for {
-		n, err = port.Read(buff)
+		line, err := readLine(port, time.Time{})
+		if err == io.EOF {
+			fmt.Println("\nEOF")
+			return result
+		}
 		if err != nil {
 			log.Fatal(err)
-			break
 		}
-		if n == 0 {
-			fmt.Println("\nEOF")
-			break
+		if len(request) != 0 && line == request {
+			continue
 		}
-		//fmt.Printf("%v\n", string(buff[:n]))
-		switch string(buff[:n]) {
-		case "\r":
-			//fmt.Println("found carriage return")
-		case "\n":
-			//fmt.Println("found newline")
-			noofreturns++
-		default:
-			stringbuff = fmt.Sprintf("%s%s", stringbuff, string(buff[:n]))
+		fmt.Printf("result: %s\n", line)
+		result = append(result, line)
+		if line == expected || isFinalResult(line) {
+			return result
 		}
-		if noofreturns > 1 {
-			fmt.Printf("result: %s\n", stringbuff)
-			break
+	}
+}
+
+// isFinalResult reports whether the line ends the answer to a command
+func isFinalResult(line string) bool {
+	return line == "OK" || line == "ERROR" || strings.HasPrefix(line, "+CME ERROR")
+}
+
+// drainLines drops the lines that were read from port before a command is
+// written, so they are not taken as its answer
+func drainLines(port serial.Port) {
+	ch := portLines(port)
+	for {
+		select {
+		case l := <-ch:
+			if l.err != nil {
+				// the reader has stopped, keep the error for the command
+				ch <- l
+				return
+			}
+		default:
+			return
 		}
 	}
-	return stringbuff
 }
 
+// ReadWritePort writes the request of v and reads the answer up to the final
+// result code, or up to the response of v when it is set, which the answer
+// has to end with. It returns the first line of the answer.
 func ReadWritePort(port serial.Port, v RequestResponse) (response string) {
 	var n int
 	var err error
+	drainLines(port)
 	fmt.Printf("%s\n", v.Request)
 	n, err = port.Write([]byte(fmt.Sprintf("%s\r\n", v.Request)))
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Printf("Sent %v bytes\n", n)
-	resultString := ReadResponse(port)
-	if len(v.Response) != 0 && resultString != v.Response {
-		log.Fatal("response was:", resultString, "expected: ", v.Response)
-	} else {
-		response = resultString
+	result := readResult(port, v.Request, v.Response)
+	var last string
+	if len(result) != 0 {
+		response, last = result[0], result[len(result)-1]
+	}
+	if len(v.Response) != 0 && last != v.Response {
+		log.Fatal("response was:", last, "expected: ", v.Response)
 	}
 	// Wait two seconds to have this machine stabilize a bit
 	const delay = 1000 * time.Millisecond
@@ -63,3 +188,65 @@ func ReadWritePort(port serial.Port, v RequestResponse) (response string) {
 
 	return response
 }
+
+// SendCommand writes request to the device and returns the lines it answers
+// with up to the final OK. An ERROR result is returned as a *CommandError.
+// Lines that arrived before the request are dropped.
+func SendCommand(port serial.Port, request string, timeout time.Duration) ([]string, error) {
+	drainLines(port)
+	if _, err := port.Write([]byte(fmt.Sprintf("%s\r\n", request))); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	var response []string
+	for {
+		line, err := readLine(port, deadline)
+		if err != nil {
+			return response, err
+		}
+		switch {
+		case line == "OK":
+			return response, nil
+		case line == "ERROR", strings.HasPrefix(line, "+CME ERROR"):
+			return response, &CommandError{Request: request, Response: line}
+		case line == request:
+			// echo of the command
+		default:
+			response = append(response, line)
+		}
+	}
+}
+
+// WaitForURC waits for an unsolicited result line starting with prefix and
+// returns it, other lines are skipped.
+func WaitForURC(port serial.Port, prefix string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		line, err := readLine(port, deadline)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, prefix) {
+			return line, nil
+		}
+	}
+}
+
+// responseValue returns the text after prefix of the first matching line
+func responseValue(response []string, prefix string) (string, bool) {
+	for _, line := range response {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix)), true
+		}
+	}
+	return "", false
+}
+
+// splitParams splits a comma separated response and strips the quotes
+func splitParams(value string) []string {
+	params := strings.Split(value, ",")
+	for i, p := range params {
+		params[i] = strings.Trim(strings.TrimSpace(p), "\"")
+	}
+	return params
+}
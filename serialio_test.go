@@ -0,0 +1,80 @@
+package senbiotpkg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// simModule answers as a module with a ready SIM that is attached
+func simModule(request string) []string {
+	switch request {
+	case "AT+CGATT?":
+		return []string{"+CGATT:1", "OK"}
+	case "AT+CPIN?":
+		return []string{"+CPIN: READY", "OK"}
+	case "AT+NRB":
+		return []string{"REBOOTING", "OK"}
+	}
+	return []string{"OK"}
+}
+
+// waitQueued waits until the port has a line that nobody read yet
+func waitQueued(t *testing.T, port *fakePort) {
+	t.Helper()
+	for start := time.Now(); len(portLines(port)) == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("no line queued")
+		}
+	}
+}
+
+func TestReadWritePortThenSendCommand(t *testing.T) {
+	port := newFakePort(simModule)
+	if got := ReadWritePort(port, RequestResponse{Request: "AT+CGATT?"}); got != "+CGATT:1" {
+		t.Errorf("ReadWritePort(AT+CGATT?) = %q, want +CGATT:1", got)
+	}
+	if response, err := SendCommand(port, "AT+CFUN=1", DefaultTimeout); err != nil || len(response) != 0 {
+		t.Errorf("SendCommand(AT+CFUN=1) = %q, %v", response, err)
+	}
+	if err := PrepareSIM(port, ""); err != nil {
+		t.Errorf("PrepareSIM after ReadWritePort: %v", err)
+	}
+}
+
+func TestSendCommandDropsStaleLines(t *testing.T) {
+	port := newFakePort(simModule)
+	// the reboot sequence stops at REBOOTING, its OK is left over
+	if _, err := RunRequest(port, RequestResponse{Request: "AT+NRB", Response: "REBOOTING"}); err != nil {
+		t.Fatal(err)
+	}
+	waitQueued(t, port)
+	response, err := SendCommand(port, "AT+CGATT?", DefaultTimeout)
+	if err != nil || !reflect.DeepEqual(response, []string{"+CGATT:1"}) {
+		t.Errorf("SendCommand(AT+CGATT?) = %q, %v, want [+CGATT:1]", response, err)
+	}
+
+	// an unsolicited result that arrived between two commands
+	for _, b := range []byte("+CEREG: 1\r\n") {
+		port.out <- b
+	}
+	waitQueued(t, port)
+	response, err = RunRequest(port, RequestResponse{Request: "AT+CPIN?"})
+	if err != nil || !reflect.DeepEqual(response, []string{"+CPIN: READY"}) {
+		t.Errorf("RunRequest(AT+CPIN?) = %q, %v, want [+CPIN: READY]", response, err)
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	port := newFakePort(func(request string) []string {
+		return []string{"+NMGS: 1", "OK", "+NNMI:1,00"}
+	})
+	port.Write([]byte("AT+NMGS=1,00\r\n"))
+	if got := ReadResponse(port); got != "+NMGS: 1" {
+		t.Errorf("ReadResponse = %q, want +NMGS: 1", got)
+	}
+	// the line after the final result code is left for the next reader
+	if line, err := ReadLine(port, time.Second); err != nil || line != "+NNMI:1,00" {
+		t.Errorf("ReadLine after ReadResponse = %q, %v", line, err)
+	}
+}
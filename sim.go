@@ -0,0 +1,151 @@
+package senbiotpkg
+
+import (
+	"errors"
+	"fmt"
+	"go.bug.st/serial.v1"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// PINEnv is the environment variable the SIM PIN is read from
+const PINEnv = "SENBIOT_PIN"
+
+var (
+	ErrSIMNotInserted = errors.New("SIM not inserted")
+	ErrPINRequired    = errors.New("SIM PIN required")
+	ErrPUKRequired    = errors.New("SIM PUK required")
+	ErrInvalidPIN     = errors.New("SIM PIN must be 4 to 8 digits")
+)
+
+// PINRejectedError is returned by PrepareSIM when the SIM does not take the PIN
+type PINRejectedError struct {
+	Err error
+}
+
+func (e *PINRejectedError) Error() string {
+	return "SIM PIN rejected: " + e.Err.Error()
+}
+
+// simError maps the answer of AT+CPIN? to one of the SIM errors
+func simError(state string) error {
+	switch {
+	case state == "READY":
+		return nil
+	case state == "SIM PIN":
+		return ErrPINRequired
+	case state == "SIM PUK":
+		return ErrPUKRequired
+	case strings.HasSuffix(state, ": 10"), strings.HasSuffix(state, "SIM not inserted"):
+		return ErrSIMNotInserted
+	case strings.HasSuffix(state, ": 11"), strings.HasSuffix(state, "SIM PIN required"):
+		return ErrPINRequired
+	case strings.HasSuffix(state, ": 12"), strings.HasSuffix(state, "SIM PUK required"):
+		return ErrPUKRequired
+	}
+	return fmt.Errorf("SIM not ready: %s", state)
+}
+
+// SIMState returns the state of the SIM as reported by AT+CPIN?, eg READY or SIM PIN
+func SIMState(port serial.Port) (string, error) {
+	response, err := SendCommand(port, "AT+CPIN?", DefaultTimeout)
+	if cmdErr, ok := err.(*CommandError); ok {
+		return cmdErr.Response, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	state, ok := responseValue(response, "+CPIN:")
+	if !ok {
+		return "", errors.New("no +CPIN in response")
+	}
+	return state, nil
+}
+
+// CheckSIM returns nil when the SIM is ready, else ErrSIMNotInserted,
+// ErrPINRequired, ErrPUKRequired or another error
+func CheckSIM(port serial.Port) error {
+	state, err := SIMState(port)
+	if err != nil {
+		return err
+	}
+	return simError(state)
+}
+
+// UnlockSIM enters the PIN of the SIM, which must be 4 to 8 digits
+func UnlockSIM(port serial.Port, pin string) error {
+	if len(pin) < 4 || len(pin) > 8 || strings.Trim(pin, "0123456789") != "" {
+		return ErrInvalidPIN
+	}
+	_, err := SendCommand(port, fmt.Sprintf("AT+CPIN=\"%s\"", pin), DefaultTimeout)
+	return err
+}
+
+// PrepareSIM checks the SIM and unlocks it with pin when a PIN is required.
+// A PIN that is invalid or refused by the SIM gives a *PINRejectedError.
+func PrepareSIM(port serial.Port, pin string) error {
+	err := CheckSIM(port)
+	if err != ErrPINRequired || len(pin) == 0 {
+		return err
+	}
+	if err := UnlockSIM(port, pin); err != nil {
+		if _, ok := err.(*CommandError); ok || err == ErrInvalidPIN {
+			return &PINRejectedError{err}
+		}
+		return err
+	}
+	return CheckSIM(port)
+}
+
+// EnableSIM switches the radio on, as the SIM can only be read then, and
+// prepares the SIM with PrepareSIM
+func EnableSIM(port serial.Port, pin string) error {
+	if _, err := SendCommand(port, "AT+CFUN=1", DefaultTimeout); err != nil {
+		return fmt.Errorf("could not switch the radio on: %v", err)
+	}
+	return PrepareSIM(port, pin)
+}
+
+// LoadPIN returns the SIM PIN from the SENBIOT_PIN environment variable or
+// else from file. An empty PIN is returned when neither is set.
+func LoadPIN(file string) (string, error) {
+	if pin := os.Getenv(PINEnv); len(pin) != 0 {
+		return pin, nil
+	}
+	if len(file) == 0 {
+		return "", nil
+	}
+	d, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(d)), nil
+}
+
+// ReadIMSI returns the IMSI of the SIM
+func ReadIMSI(port serial.Port) (string, error) {
+	response, err := SendCommand(port, "AT+CIMI", DefaultTimeout)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range response {
+		if len(line) > 0 && strings.Trim(line, "0123456789") == "" {
+			return line, nil
+		}
+	}
+	return "", errors.New("no IMSI in response")
+}
+
+// ReadICCID returns the ICCID of the SIM
+func ReadICCID(port serial.Port) (string, error) {
+	response, err := SendCommand(port, "AT+NCCID", DefaultTimeout)
+	if err != nil {
+		return "", err
+	}
+	iccid, ok := responseValue(response, "+NCCID:")
+	if !ok {
+		return "", errors.New("no +NCCID in response")
+	}
+	return iccid, nil
+}
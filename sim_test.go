@@ -0,0 +1,131 @@
+package senbiotpkg
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSIMError(t *testing.T) {
+	tests := []struct {
+		state string
+		want  error
+	}{
+		{"READY", nil},
+		{"SIM PIN", ErrPINRequired},
+		{"SIM PUK", ErrPUKRequired},
+		{"+CME ERROR: 10", ErrSIMNotInserted},
+		{"+CME ERROR: SIM not inserted", ErrSIMNotInserted},
+		{"+CME ERROR: 11", ErrPINRequired},
+		{"+CME ERROR: SIM PIN required", ErrPINRequired},
+		{"+CME ERROR: 12", ErrPUKRequired},
+		{"+CME ERROR: SIM PUK required", ErrPUKRequired},
+	}
+	for _, test := range tests {
+		if got := simError(test.state); got != test.want {
+			t.Errorf("simError(%q) = %v, want %v", test.state, got, test.want)
+		}
+	}
+	if err := simError("SIM PIN2"); err == nil || err == ErrPINRequired {
+		t.Errorf("simError(SIM PIN2) = %v, want another error", err)
+	}
+}
+
+// simCard answers AT+CPIN as a SIM in state that is unlocked by pin
+type simCard struct {
+	state string
+	pin   string
+}
+
+func (s *simCard) answer(request string) []string {
+	switch {
+	case request == "AT+CPIN?" && strings.HasPrefix(s.state, "+CME"):
+		return []string{s.state}
+	case request == "AT+CPIN?":
+		return []string{"+CPIN: " + s.state, "OK"}
+	case strings.HasPrefix(request, "AT+CPIN="):
+		if s.state == "SIM PIN" && request == "AT+CPIN=\""+s.pin+"\"" {
+			s.state = "READY"
+			return []string{"OK"}
+		}
+		return []string{"+CME ERROR: 16"}
+	}
+	return []string{"OK"}
+}
+
+func TestPrepareSIM(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    string
+		pin      string
+		want     error
+		requests []string
+	}{
+		{"ready", "READY", "1234", nil, []string{"AT+CPIN?"}},
+		{"unlocked", "SIM PIN", "1234", nil, []string{"AT+CPIN?", "AT+CPIN=\"1234\"", "AT+CPIN?"}},
+		{"no PIN", "SIM PIN", "", ErrPINRequired, []string{"AT+CPIN?"}},
+		{"PUK", "SIM PUK", "1234", ErrPUKRequired, []string{"AT+CPIN?"}},
+		{"not inserted", "+CME ERROR: 10", "1234", ErrSIMNotInserted, []string{"AT+CPIN?"}},
+	}
+	for _, test := range tests {
+		sim := &simCard{state: test.state, pin: "1234"}
+		port := newFakePort(sim.answer)
+		if err := PrepareSIM(port, test.pin); err != test.want {
+			t.Errorf("%s: PrepareSIM = %v, want %v", test.name, err, test.want)
+		}
+		if got := port.Requests(); !reflect.DeepEqual(got, test.requests) {
+			t.Errorf("%s: requests %q, want %q", test.name, got, test.requests)
+		}
+	}
+
+	// a wrong PIN is rejected, an invalid one is not sent
+	for _, pin := range []string{"4321", "123", "123456789", "12a4"} {
+		sim := &simCard{state: "SIM PIN", pin: "1234"}
+		port := newFakePort(sim.answer)
+		err := PrepareSIM(port, pin)
+		if _, ok := err.(*PINRejectedError); !ok {
+			t.Errorf("PrepareSIM(%q) = %v, want the PIN rejected", pin, err)
+		}
+		if sent := len(port.Requests()) > 1; sent != (pin == "4321") {
+			t.Errorf("PrepareSIM(%q) sent %q", pin, port.Requests())
+		}
+	}
+}
+
+func TestEnableSIM(t *testing.T) {
+	sim := &simCard{state: "READY"}
+	port := newFakePort(sim.answer)
+	if err := EnableSIM(port, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := port.Requests(), []string{"AT+CFUN=1", "AT+CPIN?"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("requests %q, want %q", got, want)
+	}
+}
+
+func TestLoadPIN(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pin")
+	if err := ioutil.WriteFile(file, []byte("1234\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		env, file, want string
+		ok              bool
+	}{
+		{"", "", "", true},
+		{"", file, "1234", true},
+		{"5678", file, "5678", true},
+		{"5678", "", "5678", true},
+		{"", filepath.Join(dir, "missing"), "", false},
+	}
+	for _, test := range tests {
+		t.Setenv(PINEnv, test.env)
+		got, err := LoadPIN(test.file)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("LoadPIN(%q) with %s=%q = %q, %v, want %q", test.file, PINEnv, test.env, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package senbiotpkg
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"go.bug.st/serial.v1"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Position is a WGS84 latitude and longitude in degrees
+type Position struct {
+	Lat float64
+	Lon float64
+}
+
+// PositionSource tells where a survey sample was taken
+type PositionSource interface {
+	// Position returns the current position, false when there is no fix
+	Position() (Position, bool)
+}
+
+// FixedPosition is a position source for a survey from a single spot
+type FixedPosition Position
+
+func (p FixedPosition) Position() (Position, bool) {
+	return Position(p), true
+}
+
+// NMEAMaxAge is how long the last fix of a GPS is used before it counts as lost
+var NMEAMaxAge = 5 * time.Second
+
+// NMEAPosition keeps the last fix of a GPS that sends NMEA sentences
+type NMEAPosition struct {
+	// MaxAge is how long a fix is used, NMEAMaxAge by default
+	MaxAge time.Duration
+
+	mu    sync.Mutex
+	pos   Position
+	fixAt time.Time
+}
+
+// NewNMEAPosition reads NMEA sentences from r, eg the serial port of a GPS,
+// until r ends
+func NewNMEAPosition(r io.Reader) *NMEAPosition {
+	n := &NMEAPosition{MaxAge: NMEAMaxAge}
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if pos, ok := ParseNMEA(scanner.Text()); ok {
+				n.mu.Lock()
+				n.pos, n.fixAt = pos, time.Now()
+				n.mu.Unlock()
+			}
+		}
+	}()
+	return n
+}
+
+// Position returns the last fix, false when there was none for MaxAge
+func (n *NMEAPosition) Position() (Position, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fixAt.IsZero() || time.Since(n.fixAt) > n.MaxAge {
+		return Position{}, false
+	}
+	return n.pos, true
+}
+
+// ParseNMEA returns the position of a GGA or RMC sentence with a valid fix
+func ParseNMEA(sentence string) (Position, bool) {
+	sentence = strings.TrimSpace(sentence)
+	if i := strings.Index(sentence, "*"); i >= 0 {
+		sentence = sentence[:i]
+	}
+	fields := strings.Split(sentence, ",")
+	if len(fields) < 7 || len(fields[0]) != 6 || fields[0][0] != '$' {
+		return Position{}, false
+	}
+	var lat, ns, lon, ew string
+	switch fields[0][3:] {
+	case "GGA":
+		// $GPGGA,time,lat,N,lon,E,quality,...
+		if fields[6] == "0" || len(fields[6]) == 0 {
+			return Position{}, false
+		}
+		lat, ns, lon, ew = fields[2], fields[3], fields[4], fields[5]
+	case "RMC":
+		// $GPRMC,time,status,lat,N,lon,E,...
+		if fields[2] != "A" {
+			return Position{}, false
+		}
+		lat, ns, lon, ew = fields[3], fields[4], fields[5], fields[6]
+	default:
+		return Position{}, false
+	}
+	var p Position
+	var err error
+	if p.Lat, err = nmeaDegrees(lat, ns == "S"); err != nil {
+		return Position{}, false
+	}
+	if p.Lon, err = nmeaDegrees(lon, ew == "W"); err != nil {
+		return Position{}, false
+	}
+	return p, true
+}
+
+// nmeaDegrees converts ddmm.mmmm or dddmm.mmmm to degrees
+func nmeaDegrees(value string, negative bool) (float64, error) {
+	i := strings.Index(value, ".")
+	if i < 0 {
+		i = len(value)
+	}
+	if i < 3 {
+		return 0, errors.New("invalid NMEA coordinate")
+	}
+	degrees, err := strconv.ParseFloat(value[:i-2], 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(value[i-2:], 64)
+	if err != nil {
+		return 0, err
+	}
+	degrees += minutes / 60
+	if negative {
+		degrees = -degrees
+	}
+	return degrees, nil
+}
+
+// SurveySample is the signal and cell of the module at one moment
+type SurveySample struct {
+	Time         time.Time
+	RSSI         int
+	Stats        RadioStats
+	Registration Registration
+	Position     Position
+	HasPosition  bool
+}
+
+// TakeSample measures the signal (AT+CSQ), radio statistics and the cell
+// the module is registered at (AT+CEREG=2, the <n> setting is put back
+// afterwards). The position is taken from pos when it is not nil.
+func TakeSample(port serial.Port, c Setup, pos PositionSource) (SurveySample, error) {
+	s := SurveySample{Time: time.Now(), RSSI: 99}
+	if pos != nil {
+		s.Position, s.HasPosition = pos.Position()
+	}
+	response, err := SendCommand(port, "AT+CSQ", DefaultTimeout)
+	if err != nil {
+		return s, err
+	}
+	if value, ok := responseValue(response, "+CSQ:"); ok {
+		s.RSSI, _ = strconv.Atoi(splitParams(value)[0])
+	}
+	if s.Stats, err = ReadRadioStats(port, c); err != nil {
+		return s, err
+	}
+	err = withCEREGMode(port, 2, func(response []string) error {
+		if value, ok := responseValue(response, "+CEREG:"); ok {
+			s.Registration, _ = ParseCEREG(value, true)
+		}
+		return nil
+	})
+	return s, err
+}
+
+var surveyHeader = []string{"time", "lat", "lon", "rssi", "signal_power", "total_power", "tx_power",
+	"snr", "rsrq", "ecl", "earfcn", "pci", "cell_id", "reg_stat", "tac", "ci"}
+
+// fields returns the values of the sample in the order of surveyHeader,
+// lat and lon are nil without a position
+func (s SurveySample) fields() []interface{} {
+	var lat, lon interface{}
+	if s.HasPosition {
+		lat, lon = s.Position.Lat, s.Position.Lon
+	}
+	return []interface{}{s.Time.Format(time.RFC3339), lat, lon, s.RSSI, s.Stats.SignalPower,
+		s.Stats.TotalPower, s.Stats.TXPower, s.Stats.SNR, s.Stats.RSRQ, s.Stats.ECL, s.Stats.EARFCN,
+		s.Stats.PCI, s.Stats.CellID, s.Registration.Stat, s.Registration.TAC, s.Registration.CellID}
+}
+
+func (s SurveySample) record() []string {
+	fields := s.fields()
+	record := make([]string, len(fields))
+	for i, v := range fields {
+		switch v := v.(type) {
+		case nil:
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', 6, 64)
+		case int:
+			record[i] = strconv.Itoa(v)
+		case string:
+			record[i] = v
+		}
+	}
+	return record
+}
+
+// SurveyCSV writes survey samples as CSV rows
+type SurveyCSV struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewSurveyCSV returns a CSV writer for survey samples
+func NewSurveyCSV(w io.Writer) *SurveyCSV {
+	return &SurveyCSV{w: csv.NewWriter(w)}
+}
+
+// Write writes a sample, preceded by the header for the first one
+func (c *SurveyCSV) Write(s SurveySample) error {
+	if !c.header {
+		if err := c.w.Write(surveyHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	if err := c.w.Write(s.record()); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type geoJSONGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// feature returns the sample as a GeoJSON point
+func (s SurveySample) feature() geoJSONFeature {
+	properties := make(map[string]interface{})
+	fields := s.fields()
+	for i, name := range surveyHeader {
+		if name != "lat" && name != "lon" {
+			properties[name] = fields[i]
+		}
+	}
+	return geoJSONFeature{
+		Type:       "Feature",
+		Geometry:   geoJSONGeometry{Type: "Point", Coordinates: []float64{s.Position.Lon, s.Position.Lat}},
+		Properties: properties,
+	}
+}
+
+const (
+	geoJSONHead = "{\"type\":\"FeatureCollection\",\"features\":[\n"
+	geoJSONTail = "\n]}\n"
+)
+
+// SurveyGeoJSON appends survey samples with a position to a GeoJSON
+// FeatureCollection, one feature per line. After each write the file is
+// a complete collection, only its closing is rewritten for the next sample.
+type SurveyGeoJSON struct {
+	w        io.WriteSeeker
+	started  bool
+	features int
+}
+
+// NewSurveyGeoJSON returns a GeoJSON writer for survey samples, w should be empty
+func NewSurveyGeoJSON(w io.WriteSeeker) *SurveyGeoJSON {
+	return &SurveyGeoJSON{w: w}
+}
+
+// Write appends the sample when it has a position
+func (g *SurveyGeoJSON) Write(s SurveySample) error {
+	if !g.started {
+		if _, err := io.WriteString(g.w, geoJSONHead+strings.TrimPrefix(geoJSONTail, "\n")); err != nil {
+			return err
+		}
+		g.started = true
+	}
+	if !s.HasPosition {
+		return nil
+	}
+	feature, err := json.Marshal(s.feature())
+	if err != nil {
+		return err
+	}
+	// overwrite the closing of the collection
+	closing := len(geoJSONTail) - 1
+	prefix := ""
+	if g.features > 0 {
+		closing, prefix = len(geoJSONTail), ",\n"
+	}
+	if _, err := g.w.Seek(-int64(closing), io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(g.w, prefix+string(feature)+geoJSONTail); err != nil {
+		return err
+	}
+	g.features++
+	return nil
+}
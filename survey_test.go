@@ -0,0 +1,92 @@
+package senbiotpkg
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseNMEA(t *testing.T) {
+	tests := []struct {
+		sentence string
+		want     Position
+		ok       bool
+	}{
+		{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", Position{48.1173, 11.516667}, true},
+		{"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A\r\n", Position{48.1173, 11.516667}, true},
+		{"$GNGGA,101010,3352.500,S,15112.600,W,2,10,1.0,10.0,M,0.0,M,,", Position{-33.875, -151.21}, true},
+		{"$GPGGA,123519,4807.038,N,01131.000,E,0,00,,,M,,M,,*47", Position{}, false},
+		{"$GPGGA,123519,,,,,,00,,,M,,M,,", Position{}, false},
+		{"$GPRMC,123519,V,4807.038,N,01131.000,E,,,230394,,*6A", Position{}, false},
+		{"$GPGSV,3,1,11,03,03,111,00,04,15,270,00,06,01,010,00*74", Position{}, false},
+		{"$GPGGA,123519,48a7.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", Position{}, false},
+		{"$GPGGA,123519,48,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", Position{}, false},
+		{"GPGGA,123519", Position{}, false},
+		{"", Position{}, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseNMEA(test.sentence)
+		if ok != test.ok || math.Abs(got.Lat-test.want.Lat) > 1e-6 || math.Abs(got.Lon-test.want.Lon) > 1e-6 {
+			t.Errorf("ParseNMEA(%q) = %v, %v, want %v, %v", test.sentence, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestNMEAPositionMaxAge(t *testing.T) {
+	n := &NMEAPosition{MaxAge: time.Minute}
+	if _, ok := n.Position(); ok {
+		t.Error("position without a fix")
+	}
+	n.pos, n.fixAt = Position{52, 5}, time.Now()
+	if pos, ok := n.Position(); !ok || pos != (Position{52, 5}) {
+		t.Errorf("fresh fix = %v, %v", pos, ok)
+	}
+	n.fixAt = time.Now().Add(-2 * time.Minute)
+	if _, ok := n.Position(); ok {
+		t.Error("stale fix is used")
+	}
+}
+
+func TestSurveyGeoJSON(t *testing.T) {
+	f, err := ioutil.TempFile("", "survey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	g := NewSurveyGeoJSON(f)
+	samples := []SurveySample{
+		{Time: time.Unix(0, 0), RSSI: 20, Position: Position{52.1, 5.1}, HasPosition: true},
+		{Time: time.Unix(10, 0), RSSI: 21},
+		{Time: time.Unix(20, 0), RSSI: 22, Position: Position{52.2, 5.2}, HasPosition: true},
+	}
+	want := []int{1, 1, 2}
+	for i, s := range samples {
+		if err := g.Write(s); err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var collection struct {
+			Type     string
+			Features []struct {
+				Geometry struct {
+					Coordinates []float64
+				}
+				Properties map[string]interface{}
+			}
+		}
+		if err := json.Unmarshal(d, &collection); err != nil {
+			t.Fatalf("after sample %d: %v\n%s", i, err, d)
+		}
+		if collection.Type != "FeatureCollection" || len(collection.Features) != want[i] {
+			t.Fatalf("after sample %d: %s", i, d)
+		}
+	}
+}